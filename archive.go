@@ -0,0 +1,441 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// extractLimits bound how much an archive may extract.
+type extractLimits struct {
+	size  int64
+	files int
+}
+
+// defaultExtractLimits are the limits used when extracting packages.
+var defaultExtractLimits = extractLimits{size: 1 << 30, files: 100000}
+
+// archiveError is returned when an archive entry is rejected during
+// extraction.
+type archiveError struct {
+	entry  string
+	reason string
+}
+
+// Error names the rejected entry and why it was rejected.
+func (a archiveError) Error() string {
+	return fmt.Sprintf("Rejected archive entry %q: %s.", a.entry, a.reason)
+}
+
+// extractTar extracts a tar stream into a directory with the default limits.
+func extractTar(in io.Reader, dest string) error {
+	return extractTarLimits(in, dest, defaultExtractLimits)
+}
+
+// extractTarLimits extracts a tar stream into a directory. Entries may not
+// escape the directory, whether by their path, by being a symlink that points
+// outside of it, or by being written through a symlink. Only directories,
+// regular files and symlinks are extracted, anything else is rejected.
+func extractTarLimits(in io.Reader, dest string, limits extractLimits) error {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dest, 0775); err != nil {
+		return err
+	}
+
+	var size int64
+	var files int
+	var links []string
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		path, err := archivePath(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if files++; files > limits.files {
+			return archiveError{hdr.Name, "archive contains too many files"}
+		}
+		if err = checkArchiveParents(dest, path, hdr.Name); err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0775)
+		case tar.TypeReg, tar.TypeRegA:
+			if size += hdr.Size; size > limits.size {
+				return archiveError{hdr.Name, "archive is too large"}
+			}
+			err = extractFile(tr, path, archiveMode(os.FileMode(hdr.Mode)))
+		case tar.TypeSymlink:
+			if err = checkArchiveLink(dest, path, hdr); err != nil {
+				return err
+			}
+			if err = os.MkdirAll(filepath.Dir(path), 0775); err == nil {
+				os.Remove(path)
+				err = os.Symlink(filepath.FromSlash(hdr.Linkname), path)
+			}
+			if err == nil {
+				links = append(links, path)
+				err = checkArchiveLinks(dest, links, hdr.Name)
+			}
+		default:
+			return archiveError{hdr.Name,
+				fmt.Sprintf("unsupported entry type %q", hdr.Typeflag)}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archivePath gets where an entry is extracted to, rejecting entries that
+// would end up outside of dest.
+func archivePath(dest, name string) (string, error) {
+	native := filepath.FromSlash(name)
+	if len(name) == 0 {
+		return "", archiveError{name, "empty path"}
+	}
+	if path.IsAbs(name) || filepath.IsAbs(native) ||
+		len(filepath.VolumeName(native)) > 0 {
+
+		return "", archiveError{name, "absolute path"}
+	}
+
+	target := filepath.Join(dest, native)
+	if !withinDir(dest, target) {
+		return "", archiveError{name, "path escapes the destination"}
+	}
+	return target, nil
+}
+
+// checkArchiveParents rejects entries that would be written through a symlink.
+func checkArchiveParents(dest, target, name string) error {
+	for dir := filepath.Dir(target); dir != dest && withinDir(dest, dir); dir =
+		filepath.Dir(dir) {
+
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return archiveError{name, "parent directory is a symlink"}
+		}
+	}
+	return nil
+}
+
+// checkArchiveLink rejects symlinks that point outside of dest, following the
+// symlinks already extracted the way the filesystem would.
+func checkArchiveLink(dest, target string, hdr *tar.Header) error {
+	link := filepath.FromSlash(hdr.Linkname)
+	if len(link) == 0 || path.IsAbs(hdr.Linkname) || filepath.IsAbs(link) ||
+		len(filepath.VolumeName(link)) > 0 {
+
+		return archiveError{hdr.Name, "symlink target is absolute"}
+	}
+	hops := 0
+	if _, ok := resolveWithin(dest, filepath.Dir(target), link,
+		&hops); !ok {
+		return archiveError{hdr.Name, "symlink points outside the destination"}
+	}
+	return nil
+}
+
+// checkArchiveLinks checks that the extracted symlinks still resolve inside of
+// dest. A new symlink can redirect the ones extracted before it, so they're
+// checked again after every symlink.
+func checkArchiveLinks(dest string, links []string, name string) error {
+	for _, link := range links {
+		target, err := os.Readlink(link)
+		if err != nil {
+			return err
+		}
+		hops := 0
+		_, ok := resolveWithin(dest, filepath.Dir(link), target, &hops)
+		if filepath.IsAbs(target) || !ok {
+
+			os.Remove(links[len(links)-1])
+			return archiveError{name, "symlink points outside the destination"}
+		}
+	}
+	return nil
+}
+
+// maxArchiveLinkHops bounds how many symlinks are followed to resolve one.
+const maxArchiveLinkHops = 40
+
+// resolveWithin resolves a relative symlink target from dir one element at a
+// time, following the symlinks it passes through, and returns where it leads.
+// It returns false if the target, or any step on the way to it, is outside of
+// dest.
+func resolveWithin(dest, dir, link string, hops *int) (string, bool) {
+	cur := dir
+	for _, part := range strings.Split(link, string(filepath.Separator)) {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, part)
+		}
+		if !withinDir(dest, cur) {
+			return "", false
+		}
+
+		info, err := os.Lstat(cur)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		next, err := os.Readlink(cur)
+		if *hops++; err != nil || *hops > maxArchiveLinkHops ||
+			filepath.IsAbs(next) {
+
+			return "", false
+		}
+		var ok bool
+		if cur, ok = resolveWithin(dest, filepath.Dir(cur), next,
+			hops); !ok {
+
+			return "", false
+		}
+	}
+	return cur, true
+}
+
+// withinDir checks if a path is dir or inside of it. Both must be clean.
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// extractFile writes a single file from an archive, replacing a symlink that
+// might have been at its path rather than writing through it.
+func extractFile(in io.Reader, path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(path); err == nil &&
+		info.Mode()&os.ModeSymlink != 0 {
+
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, in)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// extractTarGz extracts a gzipped tar stream into a directory.
+func extractTarGz(in io.Reader, dest string) error {
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return extractTar(zr, dest)
+}
+
+const (
+	// archiveCompression is the gzip level every archive is written with.
+	archiveCompression = gzip.BestCompression
+)
+
+// archiveModTime is the modification time recorded for every archive entry.
+var archiveModTime = time.Unix(0, 0)
+
+// archiveFilter decides if a file, given by its slash separated path relative
+// to the archived directory, is included in an archive.
+type archiveFilter func(string, os.FileInfo) bool
+
+// archiveEntry is a file or symlink to be archived.
+type archiveEntry struct {
+	rel  string
+	path string
+	info os.FileInfo
+}
+
+// byArchivePath sorts archive entries by their path in the archive.
+type byArchivePath []archiveEntry
+
+func (b byArchivePath) Len() int           { return len(b) }
+func (b byArchivePath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byArchivePath) Less(i, j int) bool { return b[i].rel < b[j].rel }
+
+// archiveMode normalizes a file mode so that only whether a file is
+// executable survives archiving and extraction.
+func archiveMode(mode os.FileMode) os.FileMode {
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// archiveEntries collects the files and symlinks in a directory, skipping
+// version control directories and anything the filter rejects.
+func archiveEntries(dir string, include archiveFilter) ([]archiveEntry,
+	error) {
+
+	var entries []archiveEntry
+	err := filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil || path == dir {
+			return err
+		}
+		if info.IsDir() {
+			if vcsDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if include == nil || include(rel, info) {
+			entries = append(entries, archiveEntry{rel, path, info})
+		}
+		return nil
+	})
+
+	sort.Sort(byArchivePath(entries))
+	return entries, err
+}
+
+// archiveHeader creates the tar header of an entry. Everything that differs
+// between machines, like owners and modification times, is left out.
+func archiveHeader(e archiveEntry) (*tar.Header, error) {
+	hdr := &tar.Header{
+		Name:    e.rel,
+		ModTime: archiveModTime,
+	}
+
+	if e.info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(e.path)
+		if err != nil {
+			return nil, err
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = filepath.ToSlash(link)
+		hdr.Mode = 0777
+	} else {
+		hdr.Typeflag = tar.TypeReg
+		hdr.Mode = int64(archiveMode(e.info.Mode()))
+		hdr.Size = e.info.Size()
+	}
+	return hdr, nil
+}
+
+// writeTarGz writes the files and symlinks in a directory as a gzipped tar
+// stream, skipping version control directories and anything the filter
+// rejects. A nil filter includes everything. Archives are reproducible: the
+// same contents always produce the same bytes, regardless of the machine,
+// file owners or modification times.
+func writeTarGz(dir string, include archiveFilter, out io.Writer) error {
+	entries, err := archiveEntries(dir, include)
+	if err != nil {
+		return err
+	}
+
+	zw, err := gzip.NewWriterLevel(out, archiveCompression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	for _, e := range entries {
+		hdr, err := archiveHeader(e)
+		if err != nil {
+			return err
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		n, err := copyFileTo(tw, e.path)
+		if err != nil {
+			return err
+		} else if n != hdr.Size {
+			return fmt.Errorf("%s changed while being archived", e.rel)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// copyFileTo copies a file's contents to a writer.
+func copyFileTo(out io.Writer, path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return io.Copy(out, file)
+}
+
+// readArchiveFile reads a single file out of a gzipped tar archive, returns
+// nil if the archive doesn't contain it.
+func readArchiveFile(archive io.Reader, name string) ([]byte, error) {
+	zr, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Name == name && hdr.Typeflag != tar.TypeDir {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
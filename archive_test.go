@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	. "testing"
+	"time"
+)
+
+var testArchiveFiles = map[string]string{
+	"a/b.go":   "package a",
+	"a.go":     "package main",
+	"run.sh":   "#!/bin/sh",
+	"z/y/x.go": "package y",
+}
+
+// archiveHeaders lists the headers of a gzipped tar archive.
+func archiveHeaders(t *T, archive []byte) []*tar.Header {
+	zr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var hdrs []*tar.Header
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return hdrs
+		} else if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		hdrs = append(hdrs, hdr)
+	}
+}
+
+func TestArchive_Reproducible(t *T) {
+	dir1 := mkTree(t, testArchiveFiles)
+	defer os.RemoveAll(dir1)
+	dir2 := mkTree(t, testArchiveFiles)
+	defer os.RemoveAll(dir2)
+
+	os.Chmod(filepath.Join(dir1, "run.sh"), 0700)
+	os.Chmod(filepath.Join(dir2, "run.sh"), 0775)
+	os.Chmod(filepath.Join(dir2, "a.go"), 0600)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir2, "a", "b.go"), old, old)
+
+	var buf1, buf2 bytes.Buffer
+	if err := writeTarGz(dir1, nil, &buf1); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := writeTarGz(dir2, nil, &buf2); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Error("Expected identical archives.")
+	}
+
+	hdrs := archiveHeaders(t, buf1.Bytes())
+	order := []string{"a.go", "a/b.go", "run.sh", "z/y/x.go"}
+	if len(hdrs) != len(order) {
+		t.Fatal("Expected entries:", order, "got:", hdrs)
+	}
+	for i, hdr := range hdrs {
+		if hdr.Name != order[i] {
+			t.Errorf("Expected entry %d to be %s, got: %s", i, order[i],
+				hdr.Name)
+		}
+		if hdr.Uid != 0 || hdr.Gid != 0 || len(hdr.Uname) != 0 ||
+			!hdr.ModTime.Equal(archiveModTime) {
+
+			t.Error("Expected owners and times to be normalized:", hdr)
+		}
+		mode := int64(0644)
+		if hdr.Name == "run.sh" {
+			mode = 0755
+		}
+		if hdr.Mode != mode {
+			t.Errorf("Expected %s to have mode %o, got: %o", hdr.Name, mode,
+				hdr.Mode)
+		}
+	}
+}
+
+func TestArchive_RoundTrip(t *T) {
+	dir := mkTree(t, testArchiveFiles)
+	defer os.RemoveAll(dir)
+	os.Chmod(filepath.Join(dir, "run.sh"), 0755)
+	dest := mkTree(t, nil)
+	defer os.RemoveAll(dest)
+
+	var buf bytes.Buffer
+	if err := writeTarGz(dir, func(rel string, _ os.FileInfo) bool {
+		return rel != "a.go"
+	}, &buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := extractTarGz(&buf, dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "a.go")); err == nil {
+		t.Error("Expected a.go to be filtered out.")
+	}
+	os.Remove(filepath.Join(dir, "a.go"))
+
+	orig, _ := hashTree(dir, nil)
+	if extracted, _ := hashTree(dest, nil); extracted != orig {
+		t.Error("Expected the extracted tree to hash the same as the source.")
+	}
+}
+
+// testEntry is an entry in a handcrafted archive.
+type testEntry struct {
+	name     string
+	typeflag byte
+	link     string
+	body     string
+}
+
+// mkTar creates a tar archive from handcrafted entries.
+func mkTar(t *T, entries ...testEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag,
+			Linkname: e.link, Mode: 0644, Size: int64(len(e.body))}
+		if e.typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	return &buf
+}
+
+func TestArchive_Malicious(t *T) {
+	tests := []struct {
+		reject  string
+		entries []testEntry
+	}{
+		{"../evil", []testEntry{{"../evil", tar.TypeReg, "", "x"}}},
+		{"a/../../evil", []testEntry{{"a/../../evil", tar.TypeReg, "", "x"}}},
+		{"/etc/evil", []testEntry{{"/etc/evil", tar.TypeReg, "", "x"}}},
+		{"abs", []testEntry{{"abs", tar.TypeSymlink, "/etc", ""}}},
+		{"a/up", []testEntry{{"a/up", tar.TypeSymlink, "../../out", ""}}},
+		{"l/evil", []testEntry{
+			{"l", tar.TypeSymlink, "sub", ""},
+			{"l/evil", tar.TypeReg, "", "x"},
+		}},
+		{"d/e/b", []testEntry{
+			{"d/e/a", tar.TypeSymlink, "../..", ""},
+			{"d/e/b", tar.TypeSymlink, "a/../..", ""},
+		}},
+		{"d/e/a", []testEntry{
+			{"d/e/b", tar.TypeSymlink, "a/../..", ""},
+			{"d/e/a", tar.TypeSymlink, "../..", ""},
+		}},
+		{"dev", []testEntry{{"dev", tar.TypeChar, "", ""}}},
+		{"fifo", []testEntry{{"fifo", tar.TypeFifo, "", ""}}},
+		{"hard", []testEntry{{"hard", tar.TypeLink, "/etc/passwd", ""}}},
+	}
+
+	for _, test := range tests {
+		dest := mkTree(t, nil)
+		err := extractTar(mkTar(t, test.entries...), filepath.Join(dest, "d"))
+		aerr, ok := err.(archiveError)
+		if !ok {
+			t.Errorf("Expected %s to be rejected, got: %v", test.reject, err)
+		} else if aerr.entry != test.reject {
+			t.Errorf("Expected %s to be the rejected entry, got: %v",
+				test.reject, err)
+		}
+		if _, err = os.Lstat(filepath.Join(dest, "evil")); err == nil {
+			t.Errorf("Archive %s escaped the destination.", test.reject)
+		}
+		os.RemoveAll(dest)
+	}
+}
+
+func TestArchive_Limits(t *T) {
+	dest := mkTree(t, nil)
+	defer os.RemoveAll(dest)
+
+	archive := mkTar(t,
+		testEntry{"a", tar.TypeReg, "", "12345"},
+		testEntry{"b", tar.TypeReg, "", "12345"},
+	)
+	err := extractTarLimits(archive, dest, extractLimits{size: 8, files: 10})
+	if aerr, ok := err.(archiveError); !ok || aerr.entry != "b" {
+		t.Error("Expected b to exceed the size limit, got:", err)
+	}
+
+	archive = mkTar(t,
+		testEntry{"a", tar.TypeReg, "", "1"},
+		testEntry{"b", tar.TypeReg, "", "2"},
+	)
+	err = extractTarLimits(archive, dest, extractLimits{size: 8, files: 1})
+	if aerr, ok := err.(archiveError); !ok || aerr.entry != "b" {
+		t.Error("Expected b to exceed the file limit, got:", err)
+	}
+
+	archive = mkTar(t,
+		testEntry{"sub/", tar.TypeDir, "", ""},
+		testEntry{"l", tar.TypeSymlink, "sub/f", ""},
+		testEntry{"sub/f", tar.TypeReg, "", "ok"},
+	)
+	if err = extractTar(archive, dest); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestArchive_PackageName(t *T) {
+	for _, name := range []string{"", "/abs", "a/../b", "..", "a//b", `a\b`} {
+		if checkPackageName(name) == nil {
+			t.Errorf("Expected %q to be rejected.", name)
+		}
+	}
+	if err := checkPackageName("github.com/aarondl/pack"); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
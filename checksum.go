@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/aarondl/pack"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	hashPrefix = "sha256:"
+)
+
+// validHash matches the hashes hashTree computes.
+var validHash = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// vcsDirs are directories that are never part of a package's contents.
+var vcsDirs = map[string]bool{
+	".git": true, ".hg": true, ".svn": true, ".bzr": true,
+}
+
+// hashTree computes a checksum of a directory's contents, leaving out the
+// packages nested in it, which are given as slash separated paths relative to
+// the directory. Files are visited in lexical order and each contributes its
+// slash separated relative path, whether it is executable and its contents, so
+// the result does not depend on the machine or the file modification times.
+func hashTree(dir string, nested []string) (string, error) {
+	h := sha256.New()
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if hasString(nested, rel) || (info.IsDir() && vcsDirs[info.Name()]) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "link %s %s\x00", rel, filepath.ToSlash(target))
+		case info.Mode().IsRegular():
+			kind := "file"
+			if info.Mode()&0111 != 0 {
+				kind = "exec"
+			}
+			fmt.Fprintf(h, "%s %s %d\x00", kind, rel, info.Size())
+			if _, err = copyFileTo(h, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hashPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// nestedPackages gets the packages out of names that are nested in a package,
+// as paths relative to it.
+func nestedPackages(name string, names []string) []string {
+	var nested []string
+	for _, n := range names {
+		if strings.HasPrefix(n, name+"/") {
+			nested = append(nested, n[len(name)+1:])
+		}
+	}
+	return nested
+}
+
+// manifestHash computes a checksum of a packfile's dependency section. The
+// order the dependencies are listed in does not matter.
+func manifestHash(p *pack.Pack) string {
+	deps := make([]string, len(p.Dependencies))
+	for i, dep := range p.Dependencies {
+		deps[i] = strings.Join(strings.Fields(dep), " ")
+	}
+	sort.Strings(deps)
+
+	h := sha256.New()
+	for _, dep := range deps {
+		fmt.Fprintf(h, "%s\x00", dep)
+	}
+	return hashPrefix + hex.EncodeToString(h.Sum(nil))
+}
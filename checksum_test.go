@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/aarondl/pack"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+)
+
+// mkTree creates a directory containing the given files.
+func mkTree(t *T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "gopacktree")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0660); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+	return dir
+}
+
+func TestChecksum_HashTree(t *T) {
+	files := map[string]string{
+		"a.go":       "package a",
+		"sub/b.go":   "package sub",
+		".git/HEAD":  "ref: refs/heads/master",
+		"sub/c.yaml": "name: c",
+	}
+	dir1 := mkTree(t, files)
+	defer os.RemoveAll(dir1)
+	delete(files, ".git/HEAD")
+	dir2 := mkTree(t, files)
+	defer os.RemoveAll(dir2)
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir2, "a.go"), old, old)
+
+	hash1, err := hashTree(dir1, nil)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	hash2, err := hashTree(dir2, nil)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if !strings.HasPrefix(hash1, hashPrefix) {
+		t.Error("Expected the hash to be prefixed, got:", hash1)
+	}
+	if hash1 != hash2 {
+		t.Errorf("Expected equal hashes, got: %s %s", hash1, hash2)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir2, "a.go"), []byte("package b"), 0660)
+	if hash2, _ = hashTree(dir2, nil); hash1 == hash2 {
+		t.Error("Expected the hash to change with the contents.")
+	}
+
+	if _, err = hashTree(filepath.Join(dir2, "nope"), nil); !os.IsNotExist(err) {
+		t.Error("Expected a not exist error, got:", err)
+	}
+
+	nested, _ := hashTree(dir1, []string{"sub"})
+	os.RemoveAll(filepath.Join(dir1, "sub"))
+	if hash1, _ = hashTree(dir1, nil); nested != hash1 {
+		t.Errorf("Expected nested packages to be left out, got: %s %s",
+			nested, hash1)
+	}
+}
+
+func TestChecksum_ManifestHash(t *T) {
+	p1 := &pack.Pack{Dependencies: []string{"apple ~1.0.0", "banana"}}
+	p2 := &pack.Pack{Dependencies: []string{"banana", "apple  ~1.0.0"}}
+	p3 := &pack.Pack{Dependencies: []string{"apple ~2.0.0", "banana"}}
+
+	if manifestHash(p1) != manifestHash(p2) {
+		t.Error("Expected order and spacing not to change the hash.")
+	}
+	if manifestHash(p1) == manifestHash(p3) {
+		t.Error("Expected a changed constraint to change the hash.")
+	}
+}
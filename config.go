@@ -20,6 +20,62 @@ var config Configuration
 // Configuration holds the configuration for the gp tool.
 type Configuration struct {
 	CurrentSet string
+	Licenses   *LicensePolicy `yaml:",omitempty"`
+	// Remotes maps package names to the repositories they are fetched from.
+	Remotes map[string]string `yaml:",omitempty"`
+	// Repository is a local directory of packages to use instead of fetching
+	// packages from their repositories.
+	Repository string `yaml:",omitempty"`
+	// Registry is the base url of a gopacks registry to fetch packages from,
+	// it takes precedence over Repository.
+	Registry string `yaml:",omitempty"`
+	// Workers is the number of packages fetched at the same time.
+	Workers int `yaml:",omitempty"`
+	// Fetch controls the timeouts and retries of fetches.
+	Fetch *FetchPolicy `yaml:",omitempty"`
+	// Sources are the places packages are fetched from. Registry, Repository
+	// and Remotes are used as sources after them.
+	Sources []*Source `yaml:",omitempty"`
+	// Projects are the packfiles of the projects installed with gp pack, gp
+	// prune keeps the packages their lockfiles reference.
+	Projects []string `yaml:",omitempty"`
+}
+
+// Source is a place packages are fetched from: a registry, a local repository
+// or the packages' git repositories. Sources with a higher priority are
+// consulted first, and a source with prefixes is only consulted for the
+// packages they match. A prefix ending in /* matches everything below it,
+// any other prefix matches a package and the packages below it. Packages
+// matched by a prefix other than * are only looked up in the sources that
+// match them that way.
+type Source struct {
+	// Name identifies the source in lockfiles.
+	Name       string
+	Registry   string   `yaml:",omitempty"`
+	Repository string   `yaml:",omitempty"`
+	Git        bool     `yaml:",omitempty"`
+	Priority   int      `yaml:",omitempty"`
+	Prefixes   []string `yaml:",omitempty"`
+}
+
+// FetchPolicy controls how fetches from registries and git remotes are retried
+// when they fail temporarily. Durations are written like 30s or 5m.
+type FetchPolicy struct {
+	// Timeout bounds a single attempt.
+	Timeout string `yaml:",omitempty"`
+	// Retries is how many times a temporary failure is retried.
+	Retries *int `yaml:",omitempty"`
+	// Backoff is the delay before the first retry, it doubles with every
+	// retry after that.
+	Backoff string `yaml:",omitempty"`
+}
+
+// LicensePolicy restricts the licenses dependencies may use. Licenses are SPDX
+// identifiers. When Allowed is non-empty only those licenses are permitted,
+// Denied licenses are never permitted.
+type LicensePolicy struct {
+	Allowed []string `yaml:",omitempty"`
+	Denied  []string `yaml:",omitempty"`
 }
 
 // ensureConfig ensures that a configuration file is present. Returns true
@@ -67,13 +123,52 @@ func loadConfigReader(in io.Reader) error {
 
 // saveConfig writes the configuration.
 func saveConfig() error {
-	file, err := os.Create(filepath.Join(PATHS.GopackPath, CONFIGFILE))
+	l, err := lockConfig()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	err = saveConfigWriter(file)
-	return err
+	defer l.release()
+	return writeConfig()
+}
+
+// updateConfig changes the configuration without losing changes other
+// processes made since it was loaded: the configuration is reloaded, changed
+// by update and written while it's locked.
+func updateConfig(update func()) error {
+	l, err := lockConfig()
+	if err != nil {
+		return err
+	}
+	defer l.release()
+
+	if err = reloadConfig(); err != nil {
+		return err
+	}
+	update()
+	return writeConfig()
+}
+
+// reloadConfig replaces the configuration with the configuration file to pick
+// up changes other processes made, keeping it if there's no file.
+func reloadConfig() error {
+	all, err := ioutil.ReadFile(filepath.Join(PATHS.GopackPath, CONFIGFILE))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var c Configuration
+	if err = goyaml.Unmarshal(all, &c); err != nil {
+		return err
+	}
+	config = c
+	return nil
+}
+
+// writeConfig replaces the configuration file, callers must hold its lock.
+func writeConfig() error {
+	return writeAtomic(filepath.Join(PATHS.GopackPath, CONFIGFILE),
+		saveConfigWriter)
 }
 
 // saveConfigWriter writes the global configuration object to a writer.
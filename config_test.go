@@ -2,6 +2,9 @@ package main
 
 import (
 	"bytes"
+	"github.com/aarondl/pack"
+	"os"
+	"path/filepath"
 	. "testing"
 )
 
@@ -28,3 +31,53 @@ func Test_SaveConfig(t *T) {
 		t.Errorf("Expected:\n%s\ngot:\n%s", testConfig, str)
 	}
 }
+
+func Test_LoadConfigLicenses(t *T) {
+	conf := testConfig + "licenses:\n  allowed: [MIT]\n  denied: [GPL-3.0]\n"
+	err := loadConfigReader(bytes.NewBufferString(conf))
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if config.Licenses == nil || len(config.Licenses.Allowed) != 1 ||
+		config.Licenses.Denied[0] != "GPL-3.0" {
+
+		t.Error("Did not deserialize the license policy:", config.Licenses)
+	}
+	config.Licenses = nil
+}
+
+func Test_UpdateConfig(t *T) {
+	dir := mkTree(t, map[string]string{"project/package.yaml": "name: root"})
+	defer os.RemoveAll(dir)
+
+	var err error
+	PATHS, err = pack.NewPaths(filepath.Join(dir, "gopath"), DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer func() { config = Configuration{} }()
+
+	// Another process registers the project after this one loaded the
+	// configuration.
+	stale := config
+	file := filepath.Join(dir, "project", PACKFILE)
+	if err = registerProject(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	config = stale
+
+	if err = updateConfig(func() { config.CurrentSet = "other" }); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	config = Configuration{}
+	if err = reloadConfig(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if config.CurrentSet != "other" {
+		t.Error("Expected the update to be written, got:", config.CurrentSet)
+	}
+	if len(config.Projects) != 1 || config.Projects[0] != file {
+		t.Error("Expected the registered project to be kept, got:",
+			config.Projects)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	CREDENTIALSFILE = "credentials.yaml"
+)
+
+// credential authenticates requests to a host with either a token, sent as a
+// bearer token, or a username and password, sent as basic auth.
+type credential struct {
+	Username string `yaml:",omitempty"`
+	Password string `yaml:",omitempty"`
+	Token    string `yaml:",omitempty"`
+}
+
+// String hides the secrets of a credential so they can't end up in output.
+func (c *credential) String() string {
+	return "credential{redacted}"
+}
+
+// GoString hides the secrets of a credential printed with %#v.
+func (c *credential) GoString() string {
+	return "&credential{redacted}"
+}
+
+// header gets the value of the Authorization header for a credential.
+func (c *credential) header() string {
+	if len(c.Token) > 0 {
+		return "Bearer " + c.Token
+	}
+	auth := c.Username + ":" + c.Password
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
+}
+
+// insecureError is returned instead of sending the credential of a host in the
+// clear.
+type insecureError string
+
+// Error explains why the credential of a host wasn't sent.
+func (i insecureError) Error() string {
+	return fmt.Sprintf("Not sending the credential for %s since it doesn't "+
+		"use https, use https or remove the credential.", string(i))
+}
+
+// credentialStore holds the credentials of hosts. Credentials are read from
+// the credentials file next to the configuration, which is never written by
+// gp, and from netrc. The credentials file takes precedence. The netrc default
+// is only used for the hosts of configured sources.
+type credentialStore struct {
+	hosts   map[string]*credential
+	sources map[string]bool
+}
+
+// credentialsPath gets the path of the credentials file.
+func credentialsPath() string {
+	return filepath.Join(PATHS.GopackPath, CREDENTIALSFILE)
+}
+
+// netrcPath gets the path of the user's netrc file, $NETRC if it's set.
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); len(path) > 0 {
+		return path
+	}
+	name := ".netrc"
+	home := os.Getenv("HOME")
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+		home = os.Getenv("USERPROFILE")
+	}
+	return filepath.Join(home, name)
+}
+
+// loadCredentials reads the credentials file and netrc, either may be
+// missing.
+func loadCredentials() (*credentialStore, error) {
+	c := &credentialStore{
+		hosts:   make(map[string]*credential),
+		sources: sourceHosts(),
+	}
+
+	if err := c.loadNetrc(netrcPath()); err != nil {
+		return nil, err
+	}
+	if err := c.loadFile(credentialsPath()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// sourceHosts gets the hosts of the configured registries and git remotes.
+func sourceHosts() map[string]bool {
+	urls := []string{config.Registry}
+	for _, s := range config.Sources {
+		urls = append(urls, s.Registry)
+	}
+	for _, remote := range config.Remotes {
+		urls = append(urls, remote)
+	}
+
+	hosts := make(map[string]bool)
+	for _, raw := range urls {
+		if u, err := url.Parse(raw); err == nil && len(u.Host) > 0 {
+			hosts[strings.ToLower(u.Host)] = true
+		}
+	}
+	return hosts
+}
+
+// loadFile reads a credentials file, a yaml map of hosts to credentials. It
+// must not be readable by other users.
+func (c *credentialStore) loadFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf(
+			"Credentials file %s must only be accessible by its owner.", path)
+	}
+
+	all, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var hosts map[string]*credential
+	if err = goyaml.Unmarshal(all, &hosts); err != nil {
+		return fmt.Errorf("Credentials file %s: %v", path, err)
+	}
+	for host, cred := range hosts {
+		if cred != nil {
+			c.hosts[strings.ToLower(host)] = cred
+		}
+	}
+	return nil
+}
+
+// loadNetrc reads the machines and the default entry of a netrc file.
+func (c *credentialStore) loadNetrc(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.readNetrc(file)
+}
+
+// readNetrc parses netrc entries. Macros are skipped.
+func (c *credentialStore) readNetrc(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	var words []string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "macdef") {
+			for scanner.Scan() {
+				if len(strings.TrimSpace(scanner.Text())) == 0 {
+					break
+				}
+			}
+			continue
+		}
+		words = append(words, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// The first entry of a host wins, later ones fill a throwaway credential.
+	var cred *credential
+	for i := 0; i < len(words); i++ {
+		var value string
+		if i+1 < len(words) {
+			value = words[i+1]
+		}
+
+		switch words[i] {
+		case "machine", "default":
+			host := ""
+			if words[i] == "machine" {
+				host = strings.ToLower(value)
+				i++
+			}
+			cred = new(credential)
+			if _, ok := c.hosts[host]; !ok {
+				c.hosts[host] = cred
+			}
+		case "login":
+			if cred != nil {
+				cred.Username = value
+			}
+			i++
+		case "password":
+			if cred != nil {
+				cred.Password = value
+			}
+			i++
+		case "account":
+			i++
+		}
+	}
+	return nil
+}
+
+// lookup finds the credential of a host, which may include a port. Hosts with
+// a port fall back to the credential of the host without one, and the hosts
+// of configured sources then to the netrc default. A nil store has no
+// credentials.
+func (c *credentialStore) lookup(host string) *credential {
+	if c == nil {
+		return nil
+	}
+	host = strings.ToLower(host)
+	if cred, ok := c.hosts[host]; ok {
+		return cred
+	}
+	bare := host
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		bare = host[:i]
+		if cred, ok := c.hosts[bare]; ok {
+			return cred
+		}
+	}
+	if c.sources[host] || c.sources[bare] {
+		return c.hosts[""]
+	}
+	return nil
+}
+
+// insecure checks if credentials sent to a url could be read on the way: it
+// uses plain http and the host isn't this machine.
+func insecure(u *url.URL) bool {
+	if u.Scheme != "http" {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || !ip.IsLoopback()
+}
+
+// authorize adds the credential of the request's host to the request. It fails
+// if the credential would be sent in the clear.
+func (c *credentialStore) authorize(req *http.Request) error {
+	if req.URL.User != nil {
+		return nil
+	}
+	cred := c.lookup(req.URL.Host)
+	if cred == nil {
+		return nil
+	}
+	if insecure(req.URL) {
+		return insecureError(req.URL.Host)
+	}
+	req.Header.Set("Authorization", cred.header())
+	return nil
+}
+
+// gitEnv gets the environment git is run with to authenticate to an http
+// remote. The credential is passed as configuration through the environment
+// rather than the command line so it doesn't show up in process listings or
+// error messages.
+// A nil environment is returned when there's no credential for the remote,
+// and an error if the credential would be sent in the clear.
+func (c *credentialStore) gitEnv(remote string) ([]string, error) {
+	u, err := url.Parse(remote)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+		u.User != nil {
+
+		return nil, nil
+	}
+	cred := c.lookup(u.Host)
+	if cred == nil {
+		return nil, nil
+	}
+	if insecure(u) {
+		return nil, insecureError(u.Host)
+	}
+
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	key := fmt.Sprintf("http.%s://%s/.extraHeader", u.Scheme, u.Host)
+	return append(os.Environ(),
+		"GIT_CONFIG_COUNT="+strconv.Itoa(n+1),
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n, key),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=Authorization: %s", n,
+			cred.header()),
+	), nil
+}
+
+// urlUserinfo matches the user information of urls in text.
+var urlUserinfo = regexp.MustCompile(`(://)[^/@\s]+@`)
+
+// redact removes user information, which may hold passwords, from the urls in
+// a message.
+func redact(msg string) string {
+	return urlUserinfo.ReplaceAllString(msg, "${1}redacted@")
+}
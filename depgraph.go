@@ -25,6 +25,8 @@ type depnode struct {
 // depgraph is a dependency graph.
 type depgraph struct {
 	head *depnode
+	// backtracks is the number of times solve had to back out of a conflict.
+	backtracks int
 }
 
 // depgraphProvider allows retrieval of a dependency graph to solve.
@@ -32,6 +34,50 @@ type depgraphProvider interface {
 	GetGraph() *depgraph
 }
 
+// loadDepgraph reads a packfile and builds the unsolved dependency graph
+// rooted at the package it describes.
+func loadDepgraph(file string) (*pack.Pack, *depgraph, error) {
+	p, err := pack.ParsePackFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g, err := newPackGraph(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, g, nil
+}
+
+// newPackGraph creates a dependency graph from a pack's dependency list.
+func newPackGraph(p *pack.Pack) (*depgraph, error) {
+	head := &depnode{d: &pack.Dependency{Name: p.ImportPath}}
+	if len(head.d.Name) == 0 {
+		head.d.Name = p.Name
+	}
+	if len(p.Version) > 0 {
+		v, err := pack.ParseVersion(p.Version)
+		if err != nil {
+			return nil, err
+		}
+		head.v = v
+		head.d.Constraints = []*pack.Constraint{
+			{Operator: pack.Equal, Version: v},
+		}
+	}
+
+	head.kids = make([]*depnode, 0, len(p.Dependencies))
+	for _, dep := range p.Dependencies {
+		d, err := pack.ParseDependency(dep)
+		if err != nil {
+			return nil, err
+		}
+		head.kids = append(head.kids, &depnode{d: d})
+	}
+
+	return &depgraph{head: head}, nil
+}
+
 // String turns a depgraph into a string.
 func (g depgraph) String() string {
 	var b bytes.Buffer
@@ -40,10 +86,44 @@ func (g depgraph) String() string {
 	return b.String()
 }
 
+// depgraphVisitor is called for every node reached by depgraphWalk. active
+// is a bitmask of the ancestor depths that still have siblings to visit.
+type depgraphVisitor func(n, parent *depnode, depth uint, active uint64,
+	last bool)
+
+// depgraphWalk visits a node and then all of its children depth first.
+func depgraphWalk(n, parent *depnode, depth uint, active uint64, last bool,
+	visit depgraphVisitor) {
+
+	visit(n, parent, depth, active, last)
+
+	kids := len(n.kids)
+	for i := 0; i < kids; i++ {
+		last = i+1 == kids
+		tmpactive := active
+		if !last {
+			tmpactive |= 1 << depth
+		}
+		depgraphWalk(n.kids[i], n, depth+1, tmpactive, last, visit)
+	}
+}
+
 // depgraphVisualize builds a graph visualization.
 func depgraphVisualize(n *depnode, depth uint, active uint64, last bool,
 	b *bytes.Buffer, showConstraints, showVersions bool) {
 
+	depgraphWalk(n, nil, depth, active, last,
+		func(n, _ *depnode, depth uint, active uint64, last bool) {
+			depgraphVisualizeNode(n, depth, active, last, b,
+				showConstraints, showVersions)
+		},
+	)
+}
+
+// depgraphVisualizeNode writes a single line of a graph visualization.
+func depgraphVisualizeNode(n *depnode, depth uint, active uint64, last bool,
+	b *bytes.Buffer, showConstraints, showVersions bool) {
+
 	kids := len(n.kids)
 
 	if depth > 0 {
@@ -78,28 +158,24 @@ func depgraphVisualize(n *depnode, depth uint, active uint64, last bool,
 	if showConstraints && len(n.d.Constraints) > 0 {
 		b.WriteRune(space)
 		b.WriteByte('(')
-		for i := 0; i < len(n.d.Constraints); i++ {
-			if i != 0 {
-				b.WriteRune(space)
-			}
-			b.WriteString(n.d.Constraints[i].Operator.String())
-			b.WriteString(n.d.Constraints[i].Version.String())
-		}
+		b.WriteString(constraintString(n.d))
 		b.WriteByte(')')
 	}
 	if !last || kids > 0 || active > 0 {
 		b.WriteByte(newline)
 	}
+}
 
-	for i := 0; i < kids; i++ {
-		last = i+1 == kids
-		tmpactive := active
-		if !last {
-			tmpactive |= 1 << depth
+// constraintString formats the constraints of a dependency separated by
+// spaces.
+func constraintString(d *pack.Dependency) string {
+	var b bytes.Buffer
+	for i := 0; i < len(d.Constraints); i++ {
+		if i != 0 {
+			b.WriteRune(space)
 		}
-		depgraphVisualize(n.kids[i], depth+1, tmpactive, last, b,
-			showConstraints, showVersions)
+		b.WriteString(d.Constraints[i].Operator.String())
+		b.WriteString(d.Constraints[i].Version.String())
 	}
-
-	return
+	return b.String()
 }
@@ -133,3 +133,29 @@ func TestDepgraph_String(t *T) {
 		t.Errorf("Expected:\n%s\ngot:\n%s", expect, str)
 	}
 }
+
+func TestDepgraph_NewPackGraph(t *T) {
+	p := &pack.Pack{
+		Name:         "gopack",
+		ImportPath:   "github.com/aarondl/gopack",
+		Version:      "1.0.0",
+		Dependencies: []string{"apple ~1.0.0", "banana"},
+	}
+
+	g, err := newPackGraph(p)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	expect := "github.com/aarondl/gopack 1.0.0 (=1.0.0)\n" +
+		"├─ apple (~1.0.0)\n" +
+		"└─ banana"
+	if str := g.String(); str != expect {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expect, str)
+	}
+
+	p.Dependencies = []string{""}
+	if _, err = newPackGraph(p); err == nil {
+		t.Error("Expected an error for a bad dependency.")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	packsetLockFile = ".lock"
+	storeLockFile   = "store.lock"
+	configLockFile  = CONFIGFILE + ".lock"
+	vendorLockDir   = "locks"
+)
+
+var (
+	// errLockHeld is returned when a lock can't be taken without waiting.
+	errLockHeld = errors.New("The lock is held by another process.")
+)
+
+// fileLock is an advisory lock on a file, held until it's released or the
+// process exits. Locks are always taken in the same order so processes can't
+// deadlock: a packset or vendor directory and then the store, both through
+// lockTarget, and then a git mirror or the configuration, which are never held
+// while taking another lock.
+type fileLock struct {
+	file *os.File
+}
+
+// acquireLock takes a lock on a file, creating it if it doesn't exist. Shared
+// locks can be held by several processes at once, an exclusive lock by only
+// one. If the lock is held by another process a message is written to out
+// and it's waited for.
+func acquireLock(path string, exclusive bool, out io.Writer) (*fileLock,
+	error) {
+
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0664)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file, exclusive, false)
+	if err == errLockHeld {
+		fmt.Fprintln(out, "Waiting for another gp process to release:", path)
+		err = lockFile(file, exclusive, true)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Locking %s: %v", path, err)
+	}
+	return &fileLock{file}, nil
+}
+
+// release releases a lock, a nil lock is ignored.
+func (l *fileLock) release() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// lockPackset locks the current packset and the store, see lockTarget.
+func lockPackset(exclusiveStore bool, out io.Writer) (func(), error) {
+	return lockTarget(filepath.Join(PATHS.GopacksetPath, packsetLockFile),
+		exclusiveStore, out)
+}
+
+// lockVendor locks the vendor directory of a packfile and the store, see
+// lockTarget. The lock file is kept with gp's files so that it's never left
+// in the project.
+func lockVendor(file string, out io.Writer) (func(), error) {
+	abs, err := filepath.Abs(vendorPath(file))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return lockTarget(filepath.Join(PATHS.GopackPath, vendorLockDir,
+		hex.EncodeToString(sum[:8])+".lock"), false, out)
+}
+
+// lockTarget locks a directory packages are installed into with the lock file
+// at path, and then the store. The directory's lock is exclusive since only
+// one process may change it at a time. The store's is shared so packages can
+// be installed into several directories at the same time, or exclusive to
+// remove from it. The returned function releases both.
+func lockTarget(path string, exclusiveStore bool, out io.Writer) (func(),
+	error) {
+
+	target, err := acquireLock(path, true, out)
+	if err != nil {
+		return nil, err
+	}
+	store, err := lockStore(exclusiveStore, out)
+	if err != nil {
+		target.release()
+		return nil, err
+	}
+	return func() {
+		store.release()
+		target.release()
+	}, nil
+}
+
+// lockStore locks the store, which is shared between packsets.
+func lockStore(exclusive bool, out io.Writer) (*fileLock, error) {
+	return acquireLock(filepath.Join(PATHS.GopackPath, storeLockFile),
+		exclusive, out)
+}
+
+// lockMirror locks a git mirror against other processes cloning or updating
+// it. The lock file is kept next to the mirror.
+func lockMirror(dir string) (*fileLock, error) {
+	return acquireLock(dir+".lock", true, os.Stdout)
+}
+
+// lockConfig locks the configuration against other processes writing it.
+func lockConfig() (*fileLock, error) {
+	return acquireLock(filepath.Join(PATHS.GopackPath, configLockFile), true,
+		os.Stdout)
+}
+
+// writeAtomic writes a file by writing a temporary file next to it and
+// renaming it into place, so readers never see a partially written file.
+func writeAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path),
+		"."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0664)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
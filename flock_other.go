@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import (
+	"os"
+)
+
+// lockFile does nothing on platforms without file locking, concurrent gp
+// processes aren't protected from each other there.
+func lockFile(file *os.File, exclusive, block bool) error {
+	return nil
+}
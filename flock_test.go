@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+)
+
+func TestFlock_Exclusive(t *T) {
+	dir, err := ioutil.TempDir("", "flocktest")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "locks", packsetLockFile)
+
+	var buf bytes.Buffer
+	l, err := acquireLock(path, true, &buf)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	other, err := os.Open(path)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer other.Close()
+	if err = lockFile(other, false, false); err != errLockHeld {
+		t.Error("Expected the lock to be held, got:", err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		l, err := acquireLock(path, true, &buf)
+		if err == nil {
+			err = l.release()
+		}
+		acquired <- err
+	}()
+
+	select {
+	case err = <-acquired:
+		t.Fatal("Expected the second lock to wait, got:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err = l.release(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if err = <-acquired; err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if !strings.Contains(buf.String(), "Waiting for another gp process") {
+		t.Error("Expected a waiting message, got:", buf.String())
+	}
+}
+
+func TestFlock_Shared(t *T) {
+	dir, err := ioutil.TempDir("", "flocktest")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, storeLockFile)
+
+	var buf bytes.Buffer
+	first, err := acquireLock(path, false, &buf)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer first.release()
+	second, err := acquireLock(path, false, &buf)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer second.release()
+	if buf.Len() != 0 {
+		t.Error("Expected shared locks not to wait, got:", buf.String())
+	}
+
+	other, err := os.Open(path)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer other.Close()
+	if err = lockFile(other, true, false); err != errLockHeld {
+		t.Error("Expected an exclusive lock to be refused, got:", err)
+	}
+}
+
+func TestFlock_WriteAtomic(t *T) {
+	dir, err := ioutil.TempDir("", "flocktest")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, CONFIGFILE)
+
+	if err = ioutil.WriteFile(path, []byte("old"), 0664); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	err = writeAtomic(path, func(out io.Writer) error {
+		fmt.Fprint(out, "partial")
+		return fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Error("Expected the write to fail")
+	}
+	if all, _ := ioutil.ReadFile(path); string(all) != "old" {
+		t.Error("Expected a failed write to keep the file, got:", string(all))
+	}
+
+	err = writeAtomic(path, func(out io.Writer) error {
+		_, err := fmt.Fprint(out, "new")
+		return err
+	})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if all, _ := ioutil.ReadFile(path); string(all) != "new" {
+		t.Error("Expected the file to be replaced, got:", string(all))
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(entries) != 1 {
+		t.Error("Expected no temporary files to be left, got:", len(entries))
+	}
+}
+
+func TestFlock_Vendor(t *T) {
+	dir := mkTree(t, map[string]string{"project/package.yaml": "name: root"})
+	defer os.RemoveAll(dir)
+
+	var err error
+	PATHS, err = pack.NewPaths(filepath.Join(dir, "gopath"), DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	file := filepath.Join(dir, "project", PACKFILE)
+
+	var buf bytes.Buffer
+	unlock, err := lockVendor(file, &buf)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer unlock()
+
+	locks, err := ioutil.ReadDir(filepath.Join(PATHS.GopackPath, vendorLockDir))
+	if err != nil || len(locks) != 1 {
+		t.Fatal("Expected a vendor lock file, got:", locks, err)
+	}
+	path := filepath.Join(PATHS.GopackPath, vendorLockDir, locks[0].Name())
+	other, err := os.Open(path)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer other.Close()
+	if err = lockFile(other, false, false); err != errLockHeld {
+		t.Error("Expected the vendor directory to be locked, got:", err)
+	}
+
+	entries, _ := ioutil.ReadDir(filepath.Join(dir, "project"))
+	if len(entries) != 1 {
+		t.Error("Expected nothing to be added to the project, got:", entries)
+	}
+}
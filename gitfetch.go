@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gitCacheDir = "git"
+)
+
+// fetcher installs the source of a package version into a directory.
+type fetcher interface {
+	Fetch(string, *pack.Version, string) error
+}
+
+// gitFetcher fetches packages from git repositories. Each repository is
+// mirrored into a cache directory and versions are exported from its tags.
+type gitFetcher struct {
+	cache string
+	creds *credentialStore
+	retry *retryPolicy
+	// updated holds the mirrors that have been updated by this process.
+	updated map[string]bool
+	mu      sync.Mutex
+}
+
+// newGitFetcher creates a git fetcher that mirrors repositories into cache.
+func newGitFetcher(cache string) *gitFetcher {
+	return &gitFetcher{cache: cache, updated: make(map[string]bool)}
+}
+
+// isUpdated checks if a mirror has been updated by this process.
+func (g *gitFetcher) isUpdated(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.updated[name]
+}
+
+// gitRemote gets the remote repository of a package. Remotes can be set in the
+// configuration, otherwise the package's import path is fetched over https.
+func gitRemote(name string) string {
+	if remote, ok := config.Remotes[name]; ok {
+		return remote
+	}
+	return "https://" + name
+}
+
+// runGit runs a git command, returning its output. Errors include whatever git
+// wrote to stderr.
+func runGit(dir string, args ...string) (string, error) {
+	return runGitEnv(dir, nil, 0, args...)
+}
+
+// runGitEnv runs a git command with an environment, nil meaning the current
+// process's, killing it if it takes longer than a non-zero timeout. Git runs in
+// its own process group so the helpers it starts, which hold on to its output,
+// are killed with it. Passwords in urls are redacted from errors.
+func runGitEnv(dir string, env []string, timeout time.Duration,
+	args ...string) (string, error) {
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	startGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, func() { killGroup(cmd) })
+	}
+	err := cmd.Wait()
+	if timer != nil && !timer.Stop() {
+		err = fmt.Errorf("timed out after %v", timeout)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s",
+			redact(strings.Join(args, " ")), err,
+			redact(strings.TrimSpace(stderr.String())))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// mirror ensures an up to date mirror of the package's repository exists in
+// the cache and returns its path. Mirrors are only updated once per process,
+// and are locked while they're cloned or updated since the cache is shared by
+// every gp process. Clones and updates that fail temporarily are retried, a
+// partial clone is removed before its retry. Names come from packfiles, so
+// they're checked before they're used as a path.
+func (g *gitFetcher) mirror(name string) (string, error) {
+	if err := checkPackageName(name); err != nil {
+		return "", err
+	}
+	dir := filepath.Join(g.cache, filepath.FromSlash(name)+".git")
+	if g.isUpdated(name) {
+		return dir, nil
+	}
+
+	remote := gitRemote(name)
+	env, err := g.creds.gitEnv(remote)
+	if err != nil {
+		return "", err
+	}
+	timeout := g.retry.attemptTimeout()
+
+	lock, err := lockMirror(dir)
+	if err != nil {
+		return "", err
+	}
+	defer lock.release()
+
+	_, err = os.Stat(dir)
+	if os.IsNotExist(err) {
+		err = g.retry.do(func() error {
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+			_, err := runGitEnv("", env, timeout, "clone", "--mirror",
+				"--quiet", remote, dir)
+			return classifyGit(err)
+		})
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	} else if err == nil {
+		err = g.retry.do(func() error {
+			_, err := runGitEnv(dir, env, timeout, "remote", "update",
+				"--prune")
+			return classifyGit(err)
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	g.mu.Lock()
+	g.updated[name] = true
+	g.mu.Unlock()
+	return dir, nil
+}
+
+// revision finds the commit of the tag for a version, tags may optionally be
+// prefixed with a v.
+func (g *gitFetcher) revision(dir, name string, v *pack.Version) (string,
+	error) {
+
+	for _, tag := range []string{"v" + v.String(), v.String()} {
+		rev, err := runGit(dir, "rev-parse", "--verify", "--quiet",
+			"refs/tags/"+tag+"^{commit}")
+		if err == nil && len(rev) > 0 {
+			return rev, nil
+		}
+	}
+	return "", fmt.Errorf("No tag found for %s %v", name, v)
+}
+
+// Fetch exports the tagged version of a package into dest, replacing anything
+// that was there before.
+func (g *gitFetcher) Fetch(name string, v *pack.Version, dest string) error {
+	dir, err := g.mirror(name)
+	if err != nil {
+		return err
+	}
+
+	rev, err := g.revision(dir, name, v)
+	if err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dest, 0775); err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "archive", "--format=tar", rev)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	err = extractTar(out, dest)
+	io.Copy(ioutil.Discard, out)
+	if werr := cmd.Wait(); werr != nil {
+		return fmt.Errorf("git archive %s: %v: %s", rev, werr,
+			strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	. "testing"
+	"time"
+)
+
+// mkGitRepo creates a git repository with a tagged commit for each version,
+// each version's files are written before committing.
+func mkGitRepo(t *T, versions []string, files []map[string]string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := mkTree(t, nil)
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=gopack",
+			"-c", "user.email=gopack@example.com"}, args...)
+		if _, err := runGit(dir, args...); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+
+	git("init", "--quiet")
+	for i, version := range versions {
+		for name, contents := range files[i] {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(path), 0775)
+			if err := ioutil.WriteFile(path, []byte(contents), 0664); err != nil {
+				t.Fatal("Unexpected error:", err)
+			}
+		}
+		git("add", "-A")
+		git("commit", "--quiet", "-m", version)
+		git("tag", version)
+	}
+	return dir
+}
+
+func TestGitFetch(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	repo := mkGitRepo(t, []string{"v1.0.0", "1.1.0"}, []map[string]string{
+		{"apple.go": "package apple // 1.0.0"},
+		{"apple.go": "package apple // 1.1.0", "sub/sub.go": "package sub"},
+	})
+	defer os.RemoveAll(repo)
+	bare := repo + ".git"
+	if _, err := runGit("", "clone", "--bare", "--quiet", repo, bare); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer os.RemoveAll(bare)
+
+	cache := mkTree(t, nil)
+	defer os.RemoveAll(cache)
+	config.Remotes = map[string]string{
+		"example.com/apple": "file://" + repo,
+		"example.com/bare":  bare,
+	}
+	defer func() { config.Remotes = nil }()
+
+	g := newGitFetcher(cache)
+	dest := filepath.Join(cache, "dest")
+
+	if err := g.Fetch("example.com/apple", mkVers("1.0.0")[0], dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dest, "apple.go")); string(b) !=
+		"package apple // 1.0.0" {
+
+		t.Error("Wrong contents fetched:", string(b))
+	}
+	if _, err := os.Stat(filepath.Join(dest, ".git")); err == nil {
+		t.Error("Did not expect the git directory to be exported.")
+	}
+
+	if err := g.Fetch("example.com/bare", mkVers("1.1.0")[0], dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "sub", "sub.go")); err != nil {
+		t.Error("Expected sub/sub.go to be fetched:", err)
+	}
+
+	if err := g.Fetch("example.com/apple", mkVers("2.0.0")[0], dest); err == nil {
+		t.Error("Expected an error for a missing tag.")
+	}
+}
+
+func TestGitFetch_Remote(t *T) {
+	config.Remotes = map[string]string{"a": "file:///a"}
+	defer func() { config.Remotes = nil }()
+
+	for name, remote := range map[string]string{
+		"a":              "file:///a",
+		"github.com/a/b": "https://github.com/a/b",
+	} {
+		if r := gitRemote(name); r != remote {
+			t.Errorf("Expected remote %s for %s, got: %s", remote, name, r)
+		}
+	}
+}
+
+func TestGitFetch_Timeout(t *T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// The alias runs in a shell that leaves a sleep behind holding git's
+	// output, the way git's helpers do during a clone.
+	start := time.Now()
+	_, err := runGitEnv("", nil, 100*time.Millisecond,
+		"-c", "alias.slow=!sleep 10 & sleep 10", "slow")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Error("Expected a timeout, got:", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Error("Expected the children of git to be killed, took:", elapsed)
+	}
+}
+
+func TestGitFetch_Locked(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	repo := mkGitRepo(t, []string{"1.0.0"}, []map[string]string{
+		{"apple.go": "package apple"},
+	})
+	defer os.RemoveAll(repo)
+	cache := mkTree(t, nil)
+	defer os.RemoveAll(cache)
+	config.Remotes = map[string]string{"example.com/apple": "file://" + repo}
+	defer func() { config.Remotes = nil }()
+
+	dir := filepath.Join(cache, "example.com", "apple.git")
+	lock, err := lockMirror(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	mirrored := make(chan error)
+	go func() {
+		_, err := newGitFetcher(cache).mirror("example.com/apple")
+		mirrored <- err
+	}()
+
+	select {
+	case err = <-mirrored:
+		t.Fatal("Expected the mirror to wait for the lock, got:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err = os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be cloned while locked, got:", err)
+	}
+	if err = lock.release(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if err = <-mirrored; err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if _, err = os.Stat(dir); err != nil {
+		t.Error("Expected the mirror to be cloned:", err)
+	}
+}
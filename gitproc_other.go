@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import (
+	"os/exec"
+)
+
+// startGroup does nothing on platforms without process groups.
+func startGroup(cmd *exec.Cmd) {
+}
+
+// killGroup kills a command, the processes it started are left running on
+// platforms without process groups.
+func killGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -23,9 +23,23 @@ const (
 	USAGE = `gp - Go Pack
 	
 Usage:
+ graph    - Show the dependency graph (--format tree|mermaid|markdown).
  init     - Create a package.yaml for the current package.
- pack     - Install the dependencies for the current package.
+ licenses - List the licenses of the dependencies.
+ lock     - Merge two lockfiles (merge [base] ours theirs).
+ pack     - Install the dependencies for the current package (--frozen to
+            install package.lock exactly, --workers to limit downloads).
  packset  - Use a specific packset, will create it if it doesn't exist.
+ prune    - Remove packages no registered project uses (--dry-run to list
+            them).
+ publish  - Publish the current package (-dir to publish to a directory).
+ report   - Write an html dependency report (--html file).
+ serve    - Serve a directory of packs as a registry (-addr, -publish, dir).
+ stats    - Show statistics about the dependency graph.
+ vendor   - Install the dependencies into ./vendor (--trim to leave out tests
+            and test data, --trim-files to also leave out files that
+            aren't built).
+ verify   - Check installed packages against the hashes in package.lock.
 
 Additional Help: http://gopacks.org/getstarted`
 )
@@ -63,14 +77,35 @@ func main() {
 	switch os.Args[1] {
 	case "init":
 		err = initPackage(PACKFILE, os.Args[2:], os.Stdin, os.Stdout)
+	case "graph":
+		err = showGraph(PACKFILE, os.Args[2:], os.Stdout)
+	case "licenses":
+		err = listLicenses(PACKFILE, os.Args[2:], os.Stdout)
+	case "lock":
+		err = lockCommand(PACKFILE, os.Args[2:], os.Stdout)
 	case "pack":
-		err = initPackage(PACKFILE, os.Args[2:], os.Stdin, os.Stdout)
+		err = installPackage(PACKFILE, os.Args[2:], os.Stdout)
 	case "packset":
 		err = setPackset(os.Args[2:], os.Stdout)
 		if err != nil {
 			break
 		}
-		err = saveConfig()
+		set := config.CurrentSet
+		err = updateConfig(func() { config.CurrentSet = set })
+	case "prune":
+		err = prunePackages(PACKFILE, os.Args[2:], os.Stdout)
+	case "publish":
+		err = publishPackage(PACKFILE, os.Args[2:], os.Stdout)
+	case "report":
+		err = writeReport(PACKFILE, os.Args[2:], os.Stdout)
+	case "serve":
+		err = serveRegistry(os.Args[2:], os.Stdout)
+	case "stats":
+		err = showStats(PACKFILE, os.Args[2:], os.Stdout)
+	case "vendor":
+		err = vendorPackages(PACKFILE, os.Args[2:], os.Stdout)
+	case "verify":
+		err = verifyPackage(PACKFILE, os.Args[2:], os.Stdout)
 	default:
 	}
 
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	formatTree     = "tree"
+	formatMermaid  = "mermaid"
+	formatMarkdown = "markdown"
+)
+
+// showGraph solves the packfile's dependencies and prints the resulting graph
+// in the format requested by the --format flag.
+func showGraph(file string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("graph", flag.ContinueOnError)
+	flags.SetOutput(out)
+	format := flags.String("format", formatTree,
+		"Output format: tree, mermaid or markdown.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var render func(*resolution) string
+	switch *format {
+	case formatTree:
+		render = func(r *resolution) string { return r.graph.String() }
+	case formatMermaid:
+		render = func(r *resolution) string {
+			return depgraphMermaid(r.graph)
+		}
+	case formatMarkdown:
+		render = depgraphMarkdown
+	default:
+		return fmt.Errorf("Unknown graph format: %s", *format)
+	}
+
+	r, err := resolvePackage(file)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, render(r))
+	return err
+}
+
+// depgraphMermaid renders a graph as a Mermaid flowchart. Each package is
+// drawn once, with edges labelled by the constraints placed on them.
+func depgraphMermaid(g *depgraph) string {
+	var b bytes.Buffer
+	ids := make(map[string]string)
+	edges := make(map[string]bool)
+
+	b.WriteString("flowchart TD")
+
+	depgraphWalk(g.head, nil, 0, 0, false,
+		func(n, parent *depnode, _ uint, _ uint64, _ bool) {
+			id, ok := ids[n.d.Name]
+			if !ok {
+				id = fmt.Sprintf("n%d", len(ids))
+				ids[n.d.Name] = id
+
+				label := n.d.Name
+				if n.v != nil {
+					label += " " + n.v.String()
+				}
+				fmt.Fprintf(&b, "\n    %s[\"%s\"]", id, mermaidEscape(label))
+			}
+
+			if parent == nil {
+				return
+			}
+
+			edge := ids[parent.d.Name] + " --> "
+			if len(n.d.Constraints) > 0 {
+				edge += fmt.Sprintf("|\"%s\"| ",
+					mermaidEscape(constraintString(n.d)))
+			}
+			edge += id
+			if !edges[edge] {
+				edges[edge] = true
+				b.WriteString("\n    ")
+				b.WriteString(edge)
+			}
+		},
+	)
+
+	return b.String()
+}
+
+// depgraphMarkdown renders the packages of a resolution as a Markdown table.
+// Licenses and homepages are filled in when the version provider can supply
+// packfiles.
+func depgraphMarkdown(r *resolution) string {
+	var b bytes.Buffer
+	var order []*depnode
+	constraints := make(map[string][]string)
+
+	depgraphWalk(r.graph.head, nil, 0, 0, false,
+		func(n, parent *depnode, _ uint, _ uint64, _ bool) {
+			if parent == nil {
+				return
+			}
+
+			name := n.d.Name
+			cons, seen := constraints[name]
+			if !seen {
+				order = append(order, n)
+				cons = []string{}
+			}
+			if c := constraintString(n.d); len(c) > 0 && !hasString(cons, c) {
+				cons = append(cons, c)
+			}
+			constraints[name] = cons
+		},
+	)
+
+	b.WriteString("| Package | Version | Constraints | License | Homepage |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |")
+	for _, n := range order {
+		name := n.d.Name
+		version, license, homepage := "", "", ""
+		if n.v != nil {
+			version = n.v.String()
+		}
+		if p := r.getPack(name, n.v); p != nil {
+			license, homepage = p.License, p.Homepage
+		}
+
+		fmt.Fprintf(&b, "\n| %s | %s | %s | %s | %s |",
+			markdownEscape(name), version,
+			markdownEscape(strings.Join(constraints[name], ", ")),
+			markdownEscape(license), markdownEscape(homepage))
+	}
+
+	return b.String()
+}
+
+// hasString checks if a string is in a list.
+func hasString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mermaidEscape makes text safe for use inside a quoted Mermaid label.
+func mermaidEscape(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
+
+// markdownEscape makes text safe for use inside a Markdown table cell.
+func markdownEscape(s string) string {
+	return strings.Replace(s, "|", `\|`, -1)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"github.com/aarondl/pack"
+	. "testing"
+)
+
+type testpp struct {
+	testvp
+	packs map[string]*pack.Pack
+}
+
+func (tpp *testpp) GetPack(name string, version *pack.Version) *pack.Pack {
+	return tpp.packs[name]
+}
+
+var graphTest = `
+root 1.0.0
+-apple ~1.0.0
+--durian >=0.0.1
+-banana
+--durian <=0.0.5 !=0.0.2
+`
+
+func TestGraph_Mermaid(t *T) {
+	g := mkGraph(graphTest)
+	g.head.kids[0].v = &pack.Version{1, 0, 0, ``}
+
+	expect := "flowchart TD\n" +
+		"    n0[\"root 1.0.0\"]\n" +
+		"    n1[\"apple 1.0.0\"]\n" +
+		"    n0 --> |\"~1.0.0\"| n1\n" +
+		"    n2[\"durian\"]\n" +
+		"    n1 --> |\">=0.0.1\"| n2\n" +
+		"    n3[\"banana\"]\n" +
+		"    n0 --> n3\n" +
+		"    n3 --> |\"<=0.0.5 !=0.0.2\"| n2"
+
+	if str := depgraphMermaid(g); str != expect {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expect, str)
+	}
+}
+
+func TestGraph_Markdown(t *T) {
+	r := &resolution{
+		graph: mkGraph(graphTest),
+		vp: &testpp{packs: map[string]*pack.Pack{
+			"apple": &pack.Pack{License: "MIT", Homepage: "http://a.pl|e"},
+		}},
+	}
+	r.graph.head.kids[0].v = &pack.Version{1, 0, 0, ``}
+
+	expect := "| Package | Version | Constraints | License | Homepage |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| apple | 1.0.0 | ~1.0.0 | MIT | http://a.pl\\|e |\n" +
+		"| durian |  | >=0.0.1, <=0.0.5 !=0.0.2 |  |  |\n" +
+		"| banana |  |  |  |  |"
+
+	if str := depgraphMarkdown(r); str != expect {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expect, str)
+	}
+}
+
+func TestGraph_BadFormat(t *T) {
+	var buf bytes.Buffer
+	if err := showGraph(PACKFILE, []string{"--format", "svg"}, &buf); err == nil {
+		t.Error("Expected an error for an unknown format.")
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultWorkers = 4
+)
+
+var (
+	errNoLockfile = errors.New(
+		"No package.lock found, it is required when installing with --frozen.")
+	errLockOutdated = errors.New(
+		"The dependencies in package.yaml have changed since package.lock " +
+			"was written, run gp pack to update it.")
+)
+
+// installPackage resolves the dependencies of the packfile and installs them
+// into the current packset. With --frozen the lockfile is installed as is and
+// nothing is resolved.
+func installPackage(file string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("pack", flag.ContinueOnError)
+	flags.SetOutput(out)
+	frozen := flags.Bool("frozen", false,
+		"Install exactly what package.lock specifies.")
+	workers := flags.Int("workers", config.Workers,
+		"Number of packages to fetch at once.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// The packset is locked before the lockfile is read so that it can't be
+	// changed by another process between reading and installing.
+	unlock, err := lockPackset(false, out)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if *frozen {
+		return installFrozen(file, *workers, out)
+	}
+
+	r, err := resolvePackage(file)
+	if err != nil {
+		return err
+	}
+
+	if err = checkLicenses(r, config.Licenses, out); err != nil {
+		return err
+	}
+	printActivations(r.acts, out)
+
+	lockPath := lockfilePath(file)
+	previous, err := loadLockfile(lockPath)
+	if os.IsNotExist(err) {
+		previous = new(lockfile)
+	} else if err != nil {
+		return err
+	}
+
+	f, err := resolutionFetcher(r)
+	if err != nil {
+		return err
+	}
+
+	s, err := newInstaller(f, *workers, out).stage(r.acts, previous)
+	if err != nil {
+		return err
+	}
+	defer s.discard()
+
+	lock := newLockfile(r.acts)
+	lock.Manifest = manifestHash(r.pack)
+	if err = lockSources(lock, r.vp); err != nil {
+		return err
+	}
+	if err = hashInstalled(lock, previous, s.dir); err != nil {
+		return err
+	}
+	if err = s.swap(); err != nil {
+		return err
+	}
+	if err = lock.save(lockPath); err != nil {
+		return err
+	}
+	s.commit()
+	return registerProject(file)
+}
+
+// installFrozen installs exactly the packages in the lockfile, failing if the
+// lockfile is missing or no longer matches the packfile's dependencies. The
+// packset must be locked.
+func installFrozen(file string, workers int, out io.Writer) error {
+	p, err := pack.ParsePackFile(file)
+	if err != nil {
+		return err
+	}
+
+	lock, err := loadLockfile(lockfilePath(file))
+	if os.IsNotExist(err) {
+		return errNoLockfile
+	} else if err != nil {
+		return err
+	}
+	if lock.Manifest != manifestHash(p) {
+		return errLockOutdated
+	}
+
+	r, err := lockedResolution(p, lock)
+	if err != nil {
+		return err
+	}
+
+	if err = checkLicenses(r, config.Licenses, out); err != nil {
+		return err
+	}
+	printActivations(r.acts, out)
+
+	f, err := resolutionFetcher(r)
+	if err != nil {
+		return err
+	}
+
+	s, err := newInstaller(f, workers, out).stage(r.acts, lock)
+	if err != nil {
+		return err
+	}
+	defer s.discard()
+
+	if err = verifyLockfile(lock, s.dir); err != nil {
+		return err
+	}
+	if err = s.swap(); err != nil {
+		return err
+	}
+	s.commit()
+	return registerProject(file)
+}
+
+// lockedResolution creates a resolution from a lockfile instead of solving.
+// Only the direct dependencies are present in its graph.
+func lockedResolution(p *pack.Pack, lock *lockfile) (*resolution, error) {
+	g, err := newPackGraph(p)
+	if err != nil {
+		return nil, err
+	}
+
+	vp, err := getVersionProvider()
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := vp.(*compositeProvider); ok {
+		if err = c.pin(lock); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &resolution{pack: p, graph: g, vp: vp}
+	if r.acts, err = lock.activations(); err != nil {
+		return nil, err
+	}
+	for _, kid := range g.head.kids {
+		if act, ok := r.acts[kid.d.Name]; ok {
+			kid.v = act.version
+		}
+	}
+	return r, nil
+}
+
+// printActivations lists the packages that are going to be installed.
+func printActivations(acts map[string]*activation, out io.Writer) {
+	fmt.Fprintf(out, "Resolved %d packages:\n", len(acts))
+	for _, name := range activationNames(acts) {
+		fmt.Fprintln(out, acts[name])
+	}
+}
+
+// resolutionFetcher gets the fetcher for a resolution. Version providers that
+// can fetch packages themselves are preferred.
+func resolutionFetcher(r *resolution) (fetcher, error) {
+	if f, ok := r.vp.(fetcher); ok {
+		return f, nil
+	}
+	return getFetcher()
+}
+
+// installer fetches activated packages into a store shared by every packset
+// and links them into their directories, staging them in a temporary
+// directory first.
+type installer struct {
+	f   fetcher
+	dir func(string) string
+	// tmp is where packages are staged, it must be on the same device as
+	// their directories so they can be moved into place.
+	tmp   string
+	store string
+	// copy makes independent copies of stored packages instead of linking.
+	copy    bool
+	workers int
+	out     io.Writer
+}
+
+// newInstaller creates an installer that fetches into the current packset,
+// fetching a default number of packages at once if workers isn't positive.
+func newInstaller(f fetcher, workers int, out io.Writer) *installer {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	return &installer{
+		f:       f,
+		dir:     packsetDir,
+		tmp:     PATHS.GopackPath,
+		store:   filepath.Join(PATHS.GopackPath, storeDir),
+		workers: workers,
+		out:     out,
+	}
+}
+
+// treeSize adds up the size of the files in a directory.
+func treeSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo,
+		err error) error {
+
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return err
+	})
+	return size, err
+}
+
+// hashInstalled records the hash of every installed package in the lockfile,
+// leaving out the locked packages nested in it. Packages that were locked at
+// the same version before must still match their previously recorded hash.
+func hashInstalled(lock, previous *lockfile, dir func(string) string) error {
+	var problems integrityError
+	names := lock.names()
+	for _, e := range lock.Packages {
+		hash, err := hashTree(dir(e.Name), nestedPackages(e.Name, names))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if prev := previous.find(e.Name); prev != nil &&
+			prev.Version == e.Version && len(prev.Hash) > 0 &&
+			prev.Hash != hash {
+
+			problems = append(problems, hashMismatch(e, hash, prev.Hash))
+		}
+		e.Hash = hash
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aarondl/pack"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	. "testing"
+)
+
+func TestInstall_Frozen(t *T) {
+	dir := mkTree(t, nil)
+	defer os.RemoveAll(dir)
+
+	var err error
+	PATHS, err = pack.NewPaths(filepath.Join(dir, "gopath"), DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	file := filepath.Join(dir, PACKFILE)
+	p := &pack.Pack{Name: "root", Dependencies: []string{"apple ~1.0.0"}}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var buf bytes.Buffer
+	err = installPackage(file, []string{"--frozen"}, &buf)
+	if err != errNoLockfile {
+		t.Error("Expected errNoLockfile, got:", err)
+	}
+
+	lock := &lockfile{Manifest: manifestHash(p)}
+	if err = lock.save(lockfilePath(file)); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	p.Dependencies = []string{"apple ~2.0.0"}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	err = installPackage(file, []string{"--frozen"}, &buf)
+	if err != errLockOutdated {
+		t.Error("Expected errLockOutdated, got:", err)
+	}
+}
+
+type testFetcher struct {
+	mu      sync.Mutex
+	fetched []string
+	fail    string
+}
+
+func (tf *testFetcher) Fetch(name string, v *pack.Version, dest string) error {
+	tf.mu.Lock()
+	tf.fetched = append(tf.fetched, name+" "+v.String())
+	tf.mu.Unlock()
+	if name == tf.fail {
+		return errors.New("Failed to fetch: " + name)
+	}
+	if err := os.MkdirAll(dest, 0775); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dest, "VERSION"),
+		[]byte(name+" "+v.String()), 0664)
+}
+
+func TestInstall_FetchActivations(t *T) {
+	dir := mkTree(t, nil)
+	defer os.RemoveAll(dir)
+	pkgdir := func(name string) string { return filepath.Join(dir, name) }
+
+	acts := map[string]*activation{
+		"apple":  &activation{mkDep("apple"), mkVers("1.0.0")[0], nil},
+		"banana": &activation{mkDep("banana"), mkVers("1.0.0")[0], nil},
+	}
+	previous := &lockfile{Packages: []*lockentry{
+		{Name: "apple", Version: "1.0.0"},
+		{Name: "banana", Version: "0.0.1"},
+	}}
+	os.MkdirAll(pkgdir("apple"), 0775)
+
+	var buf bytes.Buffer
+	tf := &testFetcher{}
+	in := &installer{
+		f:       tf,
+		dir:     pkgdir,
+		tmp:     dir,
+		store:   filepath.Join(dir, "store"),
+		workers: 2,
+		out:     &buf,
+	}
+	s, err := in.stage(acts, previous)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer s.discard()
+	if len(tf.fetched) != 1 || tf.fetched[0] != "banana 1.0.0" {
+		t.Error("Expected only banana to be fetched, got:", tf.fetched)
+	}
+	if str := buf.String(); !strings.Contains(str, "Fetched: banana 1.0.0") ||
+		!strings.Contains(str, "Fetched 1 of 1 packages") {
+
+		t.Error("Expected progress to be reported, got:", str)
+	}
+}
+
+func TestInstall_FetchParallel(t *T) {
+	dir := mkTree(t, nil)
+	defer os.RemoveAll(dir)
+	pkgdir := func(name string) string { return filepath.Join(dir, name) }
+	tmp := filepath.Join(dir, "tmp")
+
+	acts := make(map[string]*activation)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		acts[name] = &activation{mkDep(name), mkVers("1.0.0")[0], nil}
+	}
+
+	var buf bytes.Buffer
+	tf := &testFetcher{}
+	in := &installer{
+		f:       tf,
+		dir:     pkgdir,
+		tmp:     tmp,
+		store:   filepath.Join(dir, "store"),
+		workers: 3,
+		out:     &buf,
+	}
+	s, err := in.stage(acts, new(lockfile))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	s.discard()
+	if len(tf.fetched) != len(acts) {
+		t.Error("Expected every package to be fetched, got:", tf.fetched)
+	}
+
+	tf = &testFetcher{fail: "c"}
+	in = &installer{
+		f:       tf,
+		dir:     pkgdir,
+		tmp:     tmp,
+		store:   filepath.Join(dir, "store"),
+		workers: 3,
+		out:     &buf,
+	}
+	if _, err = in.stage(acts, new(lockfile)); err == nil ||
+		err.Error() != "Failed to fetch: c" {
+
+		t.Error("Expected c to fail, got:", err)
+	}
+	if files, _ := ioutil.ReadDir(tmp); len(files) != 0 {
+		t.Error("Expected the staging directory to be removed, got:", files)
+	}
+}
+
+func TestInstall_LocalRepository(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	root := mkTree(t, testRepository)
+	defer os.RemoveAll(root)
+	project := mkTree(t, nil)
+	defer os.RemoveAll(project)
+
+	var err error
+	PATHS, err = pack.NewPaths(filepath.Join(project, "gopath"), DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	config.Repository = root
+	defer func() {
+		config.Repository = ""
+		config.Projects = nil
+	}()
+
+	file := filepath.Join(project, PACKFILE)
+	p := &pack.Pack{Name: "root", Dependencies: []string{
+		"example.com/apple =1.0.0",
+	}}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var buf bytes.Buffer
+	if err = installPackage(file, nil, &buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	lock, err := loadLockfile(lockfilePath(file))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	apple := lock.find("example.com/apple")
+	if apple == nil || apple.Version != "1.0.0" || len(apple.Hash) == 0 {
+		t.Error("Expected apple 1.0.0 to be locked, got:", apple)
+	}
+	if banana := lock.find("example.com/banana"); banana == nil ||
+		banana.Version != "1.2.0" {
+
+		t.Error("Expected banana 1.2.0 to be locked, got:", banana)
+	}
+	if _, err = os.Stat(filepath.Join(packsetDir("example.com/apple"),
+		"apple.go")); err != nil {
+		t.Error("Expected apple to be installed:", err)
+	}
+
+	if err = installPackage(file, []string{"--frozen"}, &buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if err = verifyPackage(file, nil, &buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestInstall_FrozenExact(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	root := mkTree(t, testRepository)
+	defer os.RemoveAll(root)
+	project := mkTree(t, nil)
+	defer os.RemoveAll(project)
+
+	var err error
+	PATHS, err = pack.NewPaths(filepath.Join(project, "gopath"), DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	config.Repository = root
+	defer func() {
+		config.Repository = ""
+		config.Projects = nil
+	}()
+
+	file := filepath.Join(project, PACKFILE)
+	p := &pack.Pack{Name: "root", Dependencies: []string{
+		"example.com/banana =1.0.0",
+	}}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	var buf bytes.Buffer
+	if err = installPackage(file, nil, &buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	// Lock 1.0.0 for a range that 1.2.0 also matches.
+	p.Dependencies = []string{"example.com/banana ~1.0.0"}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	lock, err := loadLockfile(lockfilePath(file))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	lock.Manifest = manifestHash(p)
+	if err = lock.save(lockfilePath(file)); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = os.RemoveAll(PATHS.GopacksetPath); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if err = installPackage(file, []string{"--frozen"}, &buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	all, err := ioutil.ReadFile(filepath.Join(
+		packsetDir("example.com/banana"), "banana.go"))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if string(all) != "package banana" {
+		t.Error("Expected banana 1.0.0 to be installed, got:", string(all))
+	}
+	if lock, err = loadLockfile(lockfilePath(file)); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if banana := lock.find("example.com/banana"); banana == nil ||
+		banana.Version != "1.0.0" {
+
+		t.Error("Expected the lockfile to be unchanged, got:", banana)
+	}
+
+	p.Dependencies = []string{"example.com/banana ~1.2.0"}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	err = installPackage(file, []string{"--frozen"}, &buf)
+	if err != errLockOutdated {
+		t.Error("Expected errLockOutdated, got:", err)
+	}
+}
+
+func TestInstall_Nested(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	root := mkTree(t, map[string]string{
+		"example.com/apple/1.0.0/apple.go":       "package apple",
+		"example.com/apple/1.0.0/sub/sub.go":     "package sub // apple's",
+		"example.com/apple/sub/1.0.0/sub.go":     "package sub",
+		"example.com/apple/sub/1.0.0/sub_old.go": "package sub // old",
+	})
+	defer os.RemoveAll(root)
+	project := mkTree(t, nil)
+	defer os.RemoveAll(project)
+
+	var err error
+	PATHS, err = pack.NewPaths(filepath.Join(project, "gopath"), DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	config.Repository = root
+	defer func() {
+		config.Repository = ""
+		config.Projects = nil
+	}()
+
+	file := filepath.Join(project, PACKFILE)
+	p := &pack.Pack{Name: "root", Dependencies: []string{
+		"example.com/apple =1.0.0", "example.com/apple/sub =1.0.0",
+	}}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < 2; i++ {
+		if err = installPackage(file, nil, &buf); err != nil {
+			t.Fatalf("%d) Unexpected error: %v", i, err)
+		}
+	}
+	if err = verifyPackage(file, nil, &buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if err = installPackage(file, []string{"--frozen"}, &buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	all, err := ioutil.ReadFile(filepath.Join(
+		packsetDir("example.com/apple/sub"), "sub.go"))
+	if err != nil || string(all) != "package sub" {
+		t.Error("Expected apple/sub to be installed, got:", string(all), err)
+	}
+}
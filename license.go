@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	unknownLicense = "Unknown"
+)
+
+// licenseViolation is an activated package whose license breaks the policy.
+type licenseViolation struct {
+	name    string
+	license string
+	path    []string
+}
+
+// licenseError is returned when the resolved packages break the license
+// policy.
+type licenseError []licenseViolation
+
+// Error lists every violation along with how the package was reached.
+func (l licenseError) Error() string {
+	var b bytes.Buffer
+	b.WriteString("Dependencies violate the license policy:")
+	for _, v := range l {
+		fmt.Fprintf(&b, "\n %s (%s): %s", v.name, v.license,
+			strings.Join(v.path, " -> "))
+	}
+	return b.String()
+}
+
+// permits checks if the policy allows a license. A nil policy allows all.
+func (l *LicensePolicy) permits(license string) bool {
+	if l == nil {
+		return true
+	}
+	for _, denied := range l.Denied {
+		if strings.EqualFold(denied, license) {
+			return false
+		}
+	}
+	if len(l.Allowed) == 0 {
+		return true
+	}
+	for _, allowed := range l.Allowed {
+		if strings.EqualFold(allowed, license) {
+			return true
+		}
+	}
+	return false
+}
+
+// activationLicense gets the license of an activated package, unknownLicense
+// if it has no packfile or its packfile doesn't name one.
+func activationLicense(r *resolution, name string, v *pack.Version) string {
+	if p := r.getPack(name, v); p != nil && len(p.License) > 0 {
+		return p.License
+	}
+	return unknownLicense
+}
+
+// activationNames returns the names of the activated packages in order.
+func activationNames(acts map[string]*activation) []string {
+	names := make([]string, 0, len(acts))
+	for name := range acts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkLicenses checks every activated package against the license policy.
+// Packages whose license is unknown can't be checked, they're listed on out
+// instead of failing the check.
+func checkLicenses(r *resolution, policy *LicensePolicy, out io.Writer) error {
+	var violations licenseError
+	var unknown []licenseViolation
+	for _, name := range activationNames(r.acts) {
+		license := activationLicense(r, name, r.acts[name].version)
+		if license == unknownLicense {
+			unknown = append(unknown, licenseViolation{
+				name, license, activationPath(r, name),
+			})
+		} else if !policy.permits(license) {
+			violations = append(violations, licenseViolation{
+				name, license, activationPath(r, name),
+			})
+		}
+	}
+
+	if policy != nil && len(unknown) > 0 {
+		fmt.Fprintln(out, "The licenses of these dependencies are unknown, "+
+			"they were not checked against the license policy:")
+		for _, u := range unknown {
+			fmt.Fprintf(out, " %s: %s\n", u.name, strings.Join(u.path, " -> "))
+		}
+	}
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// activationPath gets how an activated package was reached from the head of
+// the graph.
+func activationPath(r *resolution, name string) []string {
+	if path := depgraphPath(r.graph, name); path != nil {
+		return path
+	}
+	return []string{r.graph.head.d.Name, "...", name}
+}
+
+// depgraphPath finds the first path from the head of the graph to a package.
+func depgraphPath(g *depgraph, name string) []string {
+	var path, found []string
+	depgraphWalk(g.head, nil, 0, 0, false,
+		func(n, _ *depnode, depth uint, _ uint64, _ bool) {
+			path = append(path[:depth], n.d.Name)
+			if found == nil && n.d.Name == name {
+				found = make([]string, len(path))
+				copy(found, path)
+			}
+		},
+	)
+	return found
+}
+
+// listLicenses prints the license of every activated package, marking those
+// that the configured policy does not permit and those that can't be checked
+// against it because their license is unknown.
+func listLicenses(file string, args []string, out io.Writer) error {
+	r, err := resolvePackage(file)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, name := range activationNames(r.acts) {
+		version := r.acts[name].version
+		license := activationLicense(r, name, version)
+		fmt.Fprintf(w, "%s\t%s\t%s", name, version, license)
+		if license == unknownLicense {
+			if config.Licenses != nil {
+				fmt.Fprint(w, "\tunchecked")
+			}
+		} else if !config.Licenses.permits(license) {
+			fmt.Fprint(w, "\tdenied")
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
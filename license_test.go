@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"github.com/aarondl/pack"
+	"strings"
+	. "testing"
+)
+
+func TestLicense_Permits(t *T) {
+	var policy *LicensePolicy
+	if !policy.permits("GPL-3.0") {
+		t.Error("A nil policy should permit everything.")
+	}
+
+	policy = &LicensePolicy{Denied: []string{"GPL-3.0"}}
+	if policy.permits("gpl-3.0") {
+		t.Error("Denied licenses should not be permitted.")
+	}
+	if !policy.permits("MIT") {
+		t.Error("Licenses not denied should be permitted.")
+	}
+
+	policy.Allowed = []string{"MIT", "BSD-3-Clause"}
+	if !policy.permits("MIT") {
+		t.Error("Allowed licenses should be permitted.")
+	}
+	if policy.permits("Apache-2.0") || policy.permits(unknownLicense) {
+		t.Error("Licenses not allowed should not be permitted.")
+	}
+}
+
+func TestLicense_Check(t *T) {
+	vp := &testpp{testvp: repository, packs: map[string]*pack.Pack{
+		"eggplant": &pack.Pack{License: "MIT"},
+		"durian":   &pack.Pack{License: "GPL-3.0"},
+	}}
+	r := &resolution{graph: mkGraph(`
+	root 1.0.0
+	-eggplant 1.0.0
+	`), vp: vp}
+
+	var err error
+	if r.acts, err = r.graph.solve(vp); err != nil {
+		t.Fatal("Solution was not found:", err)
+	}
+
+	policy := &LicensePolicy{Allowed: []string{"MIT"}}
+	var buf bytes.Buffer
+	err = checkLicenses(r, policy, &buf)
+	lerr, ok := err.(licenseError)
+	if !ok || len(lerr) != 1 {
+		t.Fatal("Expected a single license violation, got:", err)
+	}
+	if lerr[0].name != "durian" {
+		t.Error("Expected durian to be in violation, got:", lerr[0].name)
+	}
+	if path := strings.Join(lerr[0].path, " -> "); path !=
+		"root -> eggplant -> durian" {
+
+		t.Error("Wrong path to the violation:", path)
+	}
+
+	if err = checkLicenses(r, nil, &buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	delete(vp.packs, "durian")
+	if err = checkLicenses(r, policy, &buf); err != nil {
+		t.Error("Expected an unknown license not to be a violation, got:", err)
+	}
+	if str := buf.String(); !strings.Contains(str, "are unknown") ||
+		!strings.Contains(str, " durian: root -> eggplant -> durian\n") {
+
+		t.Error("Expected durian's license to be reported unknown, got:", str)
+	}
+}
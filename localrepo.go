@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// localRepository is a versionProvider and fetcher backed by a directory tree
+// laid out as <name>/<version>/, where each version directory holds the
+// package's packfile and sources.
+type localRepository struct {
+	failureLog
+	root string
+}
+
+// newLocalRepository creates a local repository rooted at a directory.
+func newLocalRepository(root string) *localRepository {
+	return &localRepository{root: root}
+}
+
+// versionDir gets the directory of a version of a package, directories may
+// optionally be prefixed with a v.
+func (l *localRepository) versionDir(name string, v *pack.Version) (string,
+	error) {
+
+	if err := checkPackageName(name); err != nil {
+		return "", err
+	}
+	dir := filepath.Join(l.root, filepath.FromSlash(name))
+	path := filepath.Join(dir, v.String())
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		vpath := filepath.Join(dir, "v"+v.String())
+		if _, verr := os.Stat(vpath); verr == nil {
+			return vpath, nil
+		}
+	}
+	return path, err
+}
+
+// GetVersions gets the versions of a package from its version directories,
+// highest first.
+func (l *localRepository) GetVersions(name string) []*pack.Version {
+	if err := checkPackageName(name); err != nil {
+		l.fail(name, err)
+		return nil
+	}
+	dir := filepath.Join(l.root, filepath.FromSlash(name))
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.fail(name, err)
+		}
+		return nil
+	}
+
+	var vs []*pack.Version
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		if v, err := parseTagVersion(info.Name()); err == nil {
+			vs = append(vs, v)
+		}
+	}
+	sort.Sort(byVersion(vs))
+	return vs
+}
+
+// GetPack reads the packfile of a version of a package. A version without a
+// packfile gets an empty pack.
+func (l *localRepository) GetPack(name string, v *pack.Version) *pack.Pack {
+	dir, err := l.versionDir(name, v)
+	if err != nil {
+		l.fail(name, err)
+		return new(pack.Pack)
+	}
+
+	p, err := pack.ParsePackFile(filepath.Join(dir, PACKFILE))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			l.fail(name, err)
+		}
+		return new(pack.Pack)
+	}
+	return p
+}
+
+// GetGraph gets the dependency graph of a version of a package.
+func (l *localRepository) GetGraph(name string, v *pack.Version) *depgraph {
+	graph, err := newPackGraph(l.GetPack(name, v))
+	if err != nil {
+		l.fail(name, err)
+		graph = &depgraph{head: &depnode{d: &pack.Dependency{Name: name}}}
+	}
+	graph.head.v = v
+	return graph
+}
+
+// Fetch copies a version of a package into dest, replacing anything that was
+// there before. Versions that were published as an archive are extracted.
+func (l *localRepository) Fetch(name string, v *pack.Version,
+	dest string) error {
+
+	dir, err := l.versionDir(name, v)
+	if err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(dest); err != nil {
+		return err
+	}
+
+	archive, err := os.Open(filepath.Join(dir, registryArchive))
+	if os.IsNotExist(err) {
+		return copyTree(dir, dest)
+	} else if err != nil {
+		return err
+	}
+	defer archive.Close()
+	return extractTarGz(archive, dest)
+}
+
+// Publish adds a version of a package to the repository. The version directory
+// holds the archive and the packfile read from it, and only appears once both
+// have been written.
+func (l *localRepository) Publish(name string, v *pack.Version,
+	archive []byte) error {
+
+	if err := checkPackageName(name); err != nil {
+		return err
+	}
+	if containsVersion(l.GetVersions(name), v) {
+		return publishedError(name + " " + v.String())
+	}
+	if err := l.Err(); err != nil {
+		return err
+	}
+
+	packfile, err := readArchiveFile(bytes.NewReader(archive), PACKFILE)
+	if err != nil {
+		return err
+	} else if packfile == nil {
+		return errNoArchivePackfile
+	}
+	if err = checkArchivePack(packfile, name, v); err != nil {
+		return err
+	}
+
+	parent := filepath.Join(l.root, filepath.FromSlash(name))
+	if err = os.MkdirAll(parent, 0775); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(parent, ".publish")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	err = ioutil.WriteFile(filepath.Join(tmp, PACKFILE), packfile, 0664)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(tmp, registryArchive), archive, 0664)
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp, 0775); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(parent, v.String()))
+}
+
+// checkArchivePack checks that the packfile of an archive describes the
+// version of the package it's published as.
+func checkArchivePack(packfile []byte, name string, v *pack.Version) error {
+	p := new(pack.Pack)
+	if err := goyaml.Unmarshal(packfile, p); err != nil {
+		return packfileMismatchError(fmt.Sprintf("%s: %v", PACKFILE, err))
+	}
+	pv, err := pack.ParseVersion(p.Version)
+	if err != nil || p.ImportPath != name || pv.String() != v.String() {
+		return packfileMismatchError(fmt.Sprintf("%s is for %s %s, not %s %s",
+			PACKFILE, p.ImportPath, p.Version, name, v))
+	}
+	return nil
+}
+
+// copyTree copies a directory's contents into another directory, skipping
+// version control directories. Permissions are normalized the same way
+// archives normalize them.
+func copyTree(src, dest string) error {
+	return mirrorTree(src, dest, copyFile)
+}
+
+// copyFile copies a single file.
+func copyFile(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return extractFile(in, dest, mode)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/aarondl/pack"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+var testRepository = map[string]string{
+	"example.com/apple/1.0.0/package.yaml": "name: apple\nlicense: MIT\n" +
+		"dependencies:\n- example.com/banana ~1.0.0\n",
+	"example.com/apple/1.0.0/apple.go":   "package apple",
+	"example.com/apple/v1.1.0/apple.go":  "package apple // 1.1.0",
+	"example.com/apple/latest/apple.go":  "package apple // latest",
+	"example.com/banana/1.0.0/banana.go": "package banana",
+	"example.com/banana/1.2.0/banana.go": "package banana // 1.2.0",
+}
+
+func TestLocalRepository(t *T) {
+	root := mkTree(t, testRepository)
+	defer os.RemoveAll(root)
+
+	l := newLocalRepository(root)
+	name := "example.com/apple"
+
+	vs := l.GetVersions(name)
+	if len(vs) != 2 || vs[0].String() != "1.1.0" || vs[1].String() != "1.0.0" {
+		t.Error("Expected versions 1.1.0 and 1.0.0, got:", vs)
+	}
+	if vs = l.GetVersions("example.com/missing"); len(vs) != 0 {
+		t.Error("Expected no versions, got:", vs)
+	}
+
+	graph := l.GetGraph(name, mkVers("1.0.0")[0])
+	if len(graph.head.kids) != 1 ||
+		graph.head.kids[0].d.Name != "example.com/banana" {
+
+		t.Error("Expected a dependency on banana, got:", graph)
+	}
+	if p := l.GetPack(name, mkVers("1.0.0")[0]); p.License != "MIT" {
+		t.Error("Expected the MIT license, got:", p.License)
+	}
+	if graph = l.GetGraph(name, mkVers("1.1.0")[0]); len(graph.head.kids) != 0 {
+		t.Error("Expected no dependencies without a packfile, got:", graph)
+	}
+	if err := l.Err(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	dest := filepath.Join(root, "dest")
+	if err := l.Fetch(name, mkVers("1.1.0")[0], dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dest, "apple.go")); string(b) !=
+		"package apple // 1.1.0" {
+
+		t.Error("Wrong contents fetched:", string(b))
+	}
+	if err := l.Fetch(name, mkVers("2.0.0")[0], dest); err == nil {
+		t.Error("Expected an error for a missing version.")
+	}
+}
+
+func TestLocalRepository_Resolve(t *T) {
+	root := mkTree(t, testRepository)
+	defer os.RemoveAll(root)
+	project := mkTree(t, nil)
+	defer os.RemoveAll(project)
+
+	var err error
+	PATHS, err = pack.NewPaths(filepath.Join(project, "gopath"), DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	file := filepath.Join(project, PACKFILE)
+	p := &pack.Pack{Name: "root", Dependencies: []string{
+		"example.com/apple =1.0.0",
+	}}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	config.Repository = root
+	defer func() { config.Repository = "" }()
+	r, err := resolvePackage(file)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(r.acts) != 2 || r.acts["example.com/banana"] == nil {
+		t.Error("Expected apple and banana to be resolved, got:", r.acts)
+	}
+}
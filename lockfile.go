@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"os"
+	"sort"
+)
+
+const (
+	// lockFormat is the lockfile format written by this version of gp.
+	lockFormat = 2
+)
+
+// lockMigrations upgrade a raw lockfile from the format they're keyed by to
+// the next format. There's one for every format before lockFormat.
+var lockMigrations = map[int]func(map[string]interface{}) error{
+	1: migrateLock1,
+}
+
+// migrateLock1 upgrades a format 1 lockfile. Format 2 records the source of
+// every package and how vendored packages were trimmed, format 1 lockfiles
+// predate sources and trimming so they're valid as is.
+func migrateLock1(raw map[string]interface{}) error {
+	return nil
+}
+
+// lockFormatError is returned when a lockfile is newer than gp understands.
+type lockFormatError int
+
+// Error explains that gp needs to be upgraded.
+func (l lockFormatError) Error() string {
+	return fmt.Sprintf("%s uses format %d but this version of gp only "+
+		"understands up to format %d, please upgrade gp.",
+		PACKLOCK, int(l), lockFormat)
+}
+
+// lockfile is the set of exact package versions a project was installed with.
+type lockfile struct {
+	// Format is the version of the lockfile format.
+	Format int
+	// Manifest is the hash of the packfile's dependencies when it was locked.
+	Manifest string `yaml:",omitempty"`
+	// Trimmed is set when vendored packages had their tests and test data
+	// removed.
+	Trimmed bool `yaml:",omitempty"`
+	// TrimmedFiles is set when vendored packages also had the files that
+	// aren't built removed.
+	TrimmedFiles bool `yaml:",omitempty"`
+	Packages     []*lockentry
+}
+
+// lockentry is a single locked package.
+type lockentry struct {
+	Name    string
+	Version string
+	// Source is the name of the configured source the package came from.
+	Source string `yaml:",omitempty"`
+	Hash   string `yaml:",omitempty"`
+}
+
+// byName sorts lock entries by name.
+type byName []*lockentry
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+
+// newLockfile creates a lockfile from a set of activations.
+func newLockfile(acts map[string]*activation) *lockfile {
+	l := &lockfile{
+		Format:   lockFormat,
+		Packages: make([]*lockentry, 0, len(acts)),
+	}
+	for _, name := range activationNames(acts) {
+		l.Packages = append(l.Packages, &lockentry{
+			Name:    name,
+			Version: acts[name].version.String(),
+		})
+	}
+	return l
+}
+
+// activations creates the set of activations recorded in the lockfile.
+func (l *lockfile) activations() (map[string]*activation, error) {
+	acts := make(map[string]*activation, len(l.Packages))
+	for _, e := range l.Packages {
+		v, err := e.version()
+		if err != nil {
+			return nil, err
+		}
+		acts[e.Name] = &activation{
+			Dependency: &pack.Dependency{Name: e.Name},
+			version:    v,
+		}
+	}
+	return acts, nil
+}
+
+// names gets the names of the locked packages.
+func (l *lockfile) names() []string {
+	names := make([]string, len(l.Packages))
+	for i, e := range l.Packages {
+		names[i] = e.Name
+	}
+	return names
+}
+
+// find looks up a package in the lockfile, returns nil if it's not present.
+func (l *lockfile) find(name string) *lockentry {
+	for _, e := range l.Packages {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// version parses the version of a lock entry.
+func (e *lockentry) version() (*pack.Version, error) {
+	return pack.ParseVersion(e.Version)
+}
+
+// loadLockfile reads a lockfile from disk. Lockfiles in an older format are
+// migrated in memory, they're only upgraded on disk when they're saved.
+func loadLockfile(file string) (*lockfile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readLockfile(f)
+}
+
+// readLockfile reads a lockfile from a reader, migrating it to the current
+// format if necessary.
+func readLockfile(in io.Reader) (*lockfile, error) {
+	all, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if err = goyaml.Unmarshal(all, &raw); err != nil {
+		return nil, err
+	}
+
+	format, err := rawLockFormat(raw)
+	if err != nil {
+		return nil, err
+	}
+	if format > lockFormat {
+		return nil, lockFormatError(format)
+	}
+
+	upgraded := format < lockFormat
+	for ; format < lockFormat; format++ {
+		if err = lockMigrations[format](raw); err != nil {
+			return nil, err
+		}
+	}
+
+	if upgraded {
+		raw["format"] = lockFormat
+		if all, err = goyaml.Marshal(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	l := new(lockfile)
+	if err = goyaml.Unmarshal(all, l); err != nil {
+		return nil, err
+	}
+	l.Format = format
+	return l, nil
+}
+
+// rawLockFormat gets the format of a raw lockfile. Lockfiles without a format
+// are format 1.
+func rawLockFormat(raw map[string]interface{}) (int, error) {
+	switch format := raw["format"].(type) {
+	case nil:
+		return 1, nil
+	case int:
+		if format > 0 {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("%s has an invalid format: %v",
+		PACKLOCK, raw["format"])
+}
+
+// save writes the lockfile to disk, replacing the previous one atomically.
+func (l *lockfile) save(file string) error {
+	return writeAtomic(file, l.write)
+}
+
+// write writes the lockfile to a writer, packages are always sorted by name.
+func (l *lockfile) write(out io.Writer) error {
+	l.Format = lockFormat
+	sort.Sort(byName(l.Packages))
+	all, err := goyaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(all)
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+var testLockfile = `format: 2
+packages:
+- name: apple
+  version: 1.0.0
+  hash: sha256:abc
+- name: banana
+  version: 0.0.1
+`
+
+func TestLockfile_ReadWrite(t *T) {
+	l, err := readLockfile(bytes.NewBufferString(testLockfile))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if len(l.Packages) != 2 {
+		t.Fatal("Expected 2 packages, got:", len(l.Packages))
+	}
+	if e := l.find("apple"); e == nil || e.Hash != "sha256:abc" {
+		t.Error("Did not deserialize apple properly:", e)
+	}
+	if e := l.find("durian"); e != nil {
+		t.Error("Did not expect to find durian:", e)
+	}
+
+	l.Packages[0], l.Packages[1] = l.Packages[1], l.Packages[0]
+	var buf bytes.Buffer
+	if err = l.write(&buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if str := buf.String(); str != testLockfile {
+		t.Errorf("Expected:\n%s\ngot:\n%s", testLockfile, str)
+	}
+}
+
+func TestLockfile_New(t *T) {
+	acts := map[string]*activation{
+		"banana": &activation{mkDep("banana"), mkVers("0.0.1")[0], nil},
+		"apple":  &activation{mkDep("apple"), mkVers("1.0.0")[0], nil},
+	}
+
+	l := newLockfile(acts)
+	if len(l.Packages) != 2 || l.Packages[0].Name != "apple" ||
+		l.Packages[1].Version != "0.0.1" {
+
+		t.Error("Lockfile was not created properly:", l.Packages)
+	}
+}
+
+func TestLockfile_NoFormat(t *T) {
+	old := testLockfile[len("format: 2\n"):]
+	l, err := readLockfile(bytes.NewBufferString(old))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if l.Format != lockFormat {
+		t.Error("Expected a lockfile without a format to be upgraded, got:",
+			l.Format)
+	}
+	if e := l.find("apple"); e == nil || e.Hash != "sha256:abc" {
+		t.Error("Did not deserialize apple properly:", e)
+	}
+}
+
+func TestLockfile_Migrate(t *T) {
+	migrate := lockMigrations[1]
+	defer func() { lockMigrations[1] = migrate }()
+
+	old := "format: 1\n" + testLockfile[len("format: 2\n"):]
+	lockMigrations[1] = func(raw map[string]interface{}) error {
+		raw["manifest"] = "sha256:migrated"
+		return migrate(raw)
+	}
+	l, err := readLockfile(bytes.NewBufferString(old))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if l.Format != lockFormat || l.Manifest != "sha256:migrated" {
+		t.Error("Expected the lockfile to be migrated, got:", l.Format,
+			l.Manifest)
+	}
+	if e := l.find("apple"); e == nil || e.Hash != "sha256:abc" {
+		t.Error("Did not deserialize apple properly:", e)
+	}
+
+	fail := errors.New("migration failed")
+	lockMigrations[1] = func(map[string]interface{}) error { return fail }
+	if _, err = readLockfile(bytes.NewBufferString(old)); err != fail {
+		t.Error("Expected the migration's error, got:", err)
+	}
+}
+
+func TestLockfile_Newer(t *T) {
+	_, err := readLockfile(bytes.NewBufferString("format: 99\npackages: []\n"))
+	if err != lockFormatError(99) {
+		t.Error("Expected a format error, got:", err)
+	}
+
+	_, err = readLockfile(bytes.NewBufferString("format: two\n"))
+	if err == nil {
+		t.Error("Expected an invalid format to fail.")
+	}
+}
+
+func TestLockfile_LoadReadOnly(t *T) {
+	old := testLockfile[len("format: 2\n"):]
+	dir := mkTree(t, map[string]string{PACKLOCK: old})
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, PACKLOCK)
+	if _, err := loadLockfile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	all, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if str := string(all); str != old {
+		t.Errorf("Expected the lockfile to be unchanged:\n%s\ngot:\n%s", old,
+			str)
+	}
+}
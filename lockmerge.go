@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"sort"
+)
+
+var (
+	errLockUsage = errors.New(
+		"Usage: gp lock merge [base] ours theirs")
+)
+
+// preferredProvider is a versionProvider that offers preferred versions of a
+// package before any others so that the solver tries them first.
+type preferredProvider struct {
+	versionProvider
+	preferred map[string][]*pack.Version
+}
+
+// byVersion sorts versions from highest to lowest.
+type byVersion []*pack.Version
+
+func (b byVersion) Len() int      { return len(b) }
+func (b byVersion) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byVersion) Less(i, j int) bool {
+	return b[i].Satisfies(pack.Greater, b[j])
+}
+
+// GetVersions gets the preferred versions followed by the remaining versions
+// from the underlying provider.
+func (p *preferredProvider) GetVersions(name string) []*pack.Version {
+	all := p.versionProvider.GetVersions(name)
+	preferred := p.preferred[name]
+	if len(preferred) == 0 {
+		return all
+	}
+
+	vs := make([]*pack.Version, 0, len(all))
+	for _, pv := range preferred {
+		for _, v := range all {
+			if v.Satisfies(pack.Equal, pv) {
+				vs = append(vs, v)
+				break
+			}
+		}
+	}
+	for _, v := range all {
+		if !containsVersion(preferred, v) {
+			vs = append(vs, v)
+		}
+	}
+	return vs
+}
+
+// containsVersion checks if a version is in a list.
+func containsVersion(vs []*pack.Version, v *pack.Version) bool {
+	for _, other := range vs {
+		if other.Satisfies(pack.Equal, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockCommand runs the gp lock subcommands.
+func lockCommand(file string, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "merge" {
+		return errLockUsage
+	}
+	return mergeLockfiles(file, args[1:], out)
+}
+
+// mergeLockfiles merges two versions of a lockfile and writes the result over
+// ours. It takes the same arguments git passes to a merge driver, which can
+// be configured with:
+//
+//	[merge "gopack"]
+//	    driver = gp lock merge %O %A %B
+func mergeLockfiles(file string, args []string, out io.Writer) error {
+	if len(args) == 3 {
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return errLockUsage
+	}
+
+	ours, err := loadLockfile(args[0])
+	if err != nil {
+		return err
+	}
+	theirs, err := loadLockfile(args[1])
+	if err != nil {
+		return err
+	}
+
+	p, g, err := loadDepgraph(file)
+	if err != nil {
+		return err
+	}
+	vp, err := getVersionProvider()
+	if err != nil {
+		return err
+	}
+
+	merged, err := mergeLocks(p, g, vp, ours, theirs)
+	if err != nil {
+		return err
+	}
+
+	if err = merged.save(args[0]); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Merged %d packages.\n", len(merged.Packages))
+	return err
+}
+
+// mergeLocks solves the graph preferring the versions found in any of the
+// lockfiles and returns the resulting lockfile. Hashes are kept from whichever
+// lockfile recorded the chosen version.
+func mergeLocks(p *pack.Pack, g *depgraph, vp versionProvider,
+	locks ...*lockfile) (*lockfile, error) {
+
+	preferred := make(map[string][]*pack.Version)
+	for _, l := range locks {
+		for _, e := range l.Packages {
+			v, err := e.version()
+			if err != nil {
+				return nil, err
+			}
+			if !containsVersion(preferred[e.Name], v) {
+				preferred[e.Name] = append(preferred[e.Name], v)
+			}
+		}
+	}
+	for _, vs := range preferred {
+		sort.Sort(byVersion(vs))
+	}
+
+	acts, err := g.solve(&preferredProvider{vp, preferred})
+	if err != nil {
+		return nil, fmt.Errorf("Could not merge lockfiles: %v", err)
+	}
+
+	merged := newLockfile(acts)
+	merged.Manifest = manifestHash(p)
+	if err = lockSources(merged, vp); err != nil {
+		return nil, err
+	}
+	for _, e := range merged.Packages {
+		for _, l := range locks {
+			if prev := l.find(e.Name); prev != nil &&
+				prev.Version == e.Version && len(prev.Hash) > 0 {
+
+				e.Hash = prev.Hash
+				break
+			}
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"github.com/aarondl/pack"
+	. "testing"
+)
+
+func TestLockMerge(t *T) {
+	ours := &lockfile{Packages: []*lockentry{
+		{Name: "apple", Version: "0.0.1", Hash: "sha256:apple"},
+		{Name: "banana", Version: "0.0.1"},
+	}}
+	theirs := &lockfile{Packages: []*lockentry{
+		{Name: "banana", Version: "0.0.1", Hash: "sha256:banana"},
+		{Name: "durian", Version: "0.0.5"},
+	}}
+
+	p := &pack.Pack{Name: "root", Dependencies: []string{"apple", "banana"}}
+	g, err := newPackGraph(p)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	merged, err := mergeLocks(p, g, &repository, ours, theirs)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var buf bytes.Buffer
+	merged.write(&buf)
+	expect := `format: 2
+manifest: ` + manifestHash(p) + `
+packages:
+- name: apple
+  version: 0.0.1
+  hash: sha256:apple
+- name: banana
+  version: 0.0.1
+  hash: sha256:banana
+- name: durian
+  version: 0.0.5
+`
+	if str := buf.String(); str != expect {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expect, str)
+	}
+
+	p.Dependencies = []string{"apple =2.0.0"}
+	if g, err = newPackGraph(p); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = mergeLocks(p, g, &repository, ours, theirs); err == nil {
+		t.Error("Expected an unresolvable merge to fail.")
+	}
+}
+
+func TestLockMerge_PreferredProvider(t *T) {
+	pp := &preferredProvider{&repository, map[string][]*pack.Version{
+		"durian": mkVers("0.0.1", "0.0.5"),
+	}}
+
+	vs := pp.GetVersions("durian")
+	expect := mkVers("0.0.1", "0.0.5", "1.0.0")
+	if len(vs) != len(expect) {
+		t.Fatal("Expected versions:", expect, "got:", vs)
+	}
+	for i := range vs {
+		if !vs[i].Satisfies(pack.Equal, expect[i]) {
+			t.Error("Expected versions:", expect, "got:", vs)
+			break
+		}
+	}
+}
+
+func TestLockMerge_Usage(t *T) {
+	var buf bytes.Buffer
+	if err := lockCommand(PACKFILE, []string{"split"}, &buf); err != errLockUsage {
+		t.Error("Expected errLockUsage, got:", err)
+	}
+	if err := lockCommand(PACKFILE, []string{"merge", "a"}, &buf); err != errLockUsage {
+		t.Error("Expected errLockUsage, got:", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/aarondl/pack"
 	"io"
+	"path/filepath"
+	"strings"
 )
 
 // setPackset sets the current packset, creating the directory if necessary.
@@ -32,3 +34,26 @@ func getPackset(out io.Writer) error {
 	_, err := fmt.Fprintln(out, config.CurrentSet)
 	return err
 }
+
+// packsetDir gets the directory a package is installed to in the current
+// packset.
+func packsetDir(name string) string {
+	return filepath.Join(PATHS.GopacksetPath, "src", filepath.FromSlash(name))
+}
+
+// checkPackageName rejects package names that could escape the directory
+// they're installed to.
+func checkPackageName(name string) error {
+	if len(name) == 0 || strings.HasPrefix(name, "/") ||
+		strings.Contains(name, "\\") ||
+		len(filepath.VolumeName(filepath.FromSlash(name))) > 0 {
+
+		return fmt.Errorf("Invalid package name: %q", name)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if len(elem) == 0 || elem == "." || elem == ".." {
+			return fmt.Errorf("Invalid package name: %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// progress reports the state of packages as they're fetched. Implementations
+// must be safe for use by multiple goroutines.
+type progress interface {
+	// start is called when a package begins fetching.
+	start(*activation)
+	// done is called when a package has been fetched or failed to fetch,
+	// size is the number of bytes installed.
+	done(*activation, int64, error)
+	// finish is called once all packages are done.
+	finish()
+}
+
+// newProgress creates a progress display for fetching total packages, the
+// display redraws itself in place when out is a terminal.
+func newProgress(out io.Writer, total int) progress {
+	if isTerminal(out) {
+		return &ttyProgress{out: out, total: total}
+	}
+	return &lineProgress{out: out, total: total}
+}
+
+// isTerminal checks if a writer is a terminal.
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// formatBytes formats a size in bytes for humans.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// lineProgress writes a line every time a package changes state.
+type lineProgress struct {
+	mu    sync.Mutex
+	out   io.Writer
+	total int
+	count int
+	bytes int64
+}
+
+func (l *lineProgress) start(a *activation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.out, "Fetching:", a)
+}
+
+func (l *lineProgress) done(a *activation, size int64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(l.out, "Failed: %v: %v\n", a, err)
+		return
+	}
+	l.count++
+	l.bytes += size
+	fmt.Fprintf(l.out, "Fetched: %v (%s) [%d/%d]\n", a, formatBytes(size),
+		l.count, l.total)
+}
+
+func (l *lineProgress) finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.out, "Fetched %d of %d packages (%s)\n", l.count, l.total,
+		formatBytes(l.bytes))
+}
+
+// ttyProgress keeps a line for every package being fetched and a summary line
+// at the bottom of the terminal, redrawing them as packages change state.
+// Finished packages scroll up above the display.
+type ttyProgress struct {
+	mu     sync.Mutex
+	out    io.Writer
+	total  int
+	count  int
+	bytes  int64
+	active []*activation
+	drawn  int
+}
+
+func (t *ttyProgress) start(a *activation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = append(t.active, a)
+	t.redraw("")
+}
+
+func (t *ttyProgress) done(a *activation, size int64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, act := range t.active {
+		if act == a {
+			t.active = append(t.active[:i], t.active[i+1:]...)
+			break
+		}
+	}
+
+	if err != nil {
+		t.redraw(fmt.Sprintf("  failed   %v: %v", a, err))
+		return
+	}
+	t.count++
+	t.bytes += size
+	t.redraw(fmt.Sprintf("  fetched  %v (%s)", a, formatBytes(size)))
+}
+
+func (t *ttyProgress) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = nil
+	t.redraw("")
+}
+
+// redraw clears the display, writes a permanent line if one is given and
+// draws the active packages and summary again.
+func (t *ttyProgress) redraw(line string) {
+	if t.drawn > 0 {
+		fmt.Fprintf(t.out, "\x1b[%dA", t.drawn)
+	}
+	fmt.Fprint(t.out, "\x1b[J")
+	if len(line) > 0 {
+		fmt.Fprintln(t.out, line)
+	}
+
+	for _, a := range t.active {
+		fmt.Fprintf(t.out, "  fetching %v\n", a)
+	}
+	fmt.Fprintf(t.out, "[%d/%d] %s\n", t.count, t.total, formatBytes(t.bytes))
+	t.drawn = len(t.active) + 1
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	. "testing"
+)
+
+func TestProgress_FormatBytes(t *T) {
+	tests := []struct {
+		n      int64
+		expect string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 << 20, "5.0 MB"},
+	}
+
+	for _, test := range tests {
+		if got := formatBytes(test.n); got != test.expect {
+			t.Errorf("%d: Expected %q, got %q", test.n, test.expect, got)
+		}
+	}
+}
+
+func TestProgress_Lines(t *T) {
+	var buf bytes.Buffer
+	prog := newProgress(&buf, 2)
+	if _, ok := prog.(*lineProgress); !ok {
+		t.Fatalf("Expected line progress for a buffer, got: %T", prog)
+	}
+
+	apple := &activation{mkDep("apple"), mkVers("1.0.0")[0], nil}
+	banana := &activation{mkDep("banana"), mkVers("2.0.0")[0], nil}
+	prog.start(apple)
+	prog.start(banana)
+	prog.done(apple, 2048, nil)
+	prog.done(banana, 0, errors.New("oops"))
+	prog.finish()
+
+	expect := []string{
+		"Fetching: apple 1.0.0",
+		"Fetching: banana 2.0.0",
+		"Fetched: apple 1.0.0 (2.0 KB) [1/2]",
+		"Failed: banana 2.0.0: oops",
+		"Fetched 1 of 2 packages (2.0 KB)",
+	}
+	got := strings.TrimSpace(buf.String())
+	if got != strings.Join(expect, "\n") {
+		t.Errorf("Unexpected output:\n%s", got)
+	}
+}
+
+func TestProgress_TTY(t *T) {
+	var buf bytes.Buffer
+	prog := &ttyProgress{out: &buf, total: 1}
+	apple := &activation{mkDep("apple"), mkVers("1.0.0")[0], nil}
+	prog.start(apple)
+	prog.done(apple, 10, nil)
+	prog.finish()
+
+	str := buf.String()
+	if !strings.Contains(str, "  fetching apple 1.0.0\n") {
+		t.Error("Expected the active package to be drawn, got:", str)
+	}
+	if !strings.Contains(str, "\x1b[2A\x1b[J  fetched  apple 1.0.0 (10 B)\n") {
+		t.Error("Expected the display to be redrawn, got:", str)
+	}
+	if !strings.HasSuffix(str, "[1/1] 10 B\n") {
+		t.Error("Expected a final summary, got:", str)
+	}
+}
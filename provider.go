@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/aarondl/pack"
+	"path/filepath"
+)
+
+// packProvider is optionally implemented by a versionProvider that can also
+// supply the full packfile for a version of a package.
+type packProvider interface {
+	GetPack(string, *pack.Version) *pack.Pack
+}
+
+// resolution is the result of solving a packfile's dependencies.
+type resolution struct {
+	pack  *pack.Pack
+	graph *depgraph
+	acts  map[string]*activation
+	vp    versionProvider
+}
+
+// getPack looks up the packfile of an activated package, returns nil if the
+// version provider cannot supply packfiles.
+func (r *resolution) getPack(name string, v *pack.Version) *pack.Pack {
+	if pp, ok := r.vp.(packProvider); ok && v != nil {
+		return pp.GetPack(name, v)
+	}
+	return nil
+}
+
+// getVersionProvider creates the version provider described by the current
+// configuration, which consults every configured source.
+func getVersionProvider() (versionProvider, error) {
+	creds, err := loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	retry, err := newRetryPolicy(config.Fetch)
+	if err != nil {
+		return nil, err
+	}
+	return newCompositeProvider(configSources(), creds, retry)
+}
+
+// getFetcher creates the fetcher described by the current configuration.
+func getFetcher() (fetcher, error) {
+	vp, err := getVersionProvider()
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := vp.(fetcher); ok {
+		return f, nil
+	}
+	return newGitFetcher(filepath.Join(PATHS.GopackPath, gitCacheDir)), nil
+}
+
+// resolvePackage loads the packfile and solves its dependency graph using the
+// configured version provider. If solving fails the partial resolution is
+// returned alongside the error.
+func resolvePackage(file string) (*resolution, error) {
+	p, g, err := loadDepgraph(file)
+	if err != nil {
+		return nil, err
+	}
+
+	vp, err := getVersionProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &resolution{pack: p, graph: g, vp: vp}
+	r.acts, err = g.solve(vp)
+	if fp, ok := vp.(failingProvider); ok && fp.Err() != nil {
+		return r, fp.Err()
+	}
+	return r, err
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errPruneNoLockfiles = errors.New(
+		"No lockfiles were found, refusing to prune every package.")
+)
+
+// pruneTarget is a directory removed by gp prune.
+type pruneTarget struct {
+	label string
+	path  string
+	size  int64
+}
+
+// prunePackages removes the packages in the current packset and the store
+// that none of the registered projects' lockfiles reference. The current
+// project's lockfile is always considered. With --dry-run nothing is removed.
+func prunePackages(file string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dryRun := flags.Bool("dry-run", false,
+		"List what would be removed without removing it.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	unlock, err := lockPackset(true, out)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Projects registered since the configuration was loaded must be kept.
+	if err = reloadConfig(); err != nil {
+		return err
+	}
+	projects, forgotten := pruneProjects()
+	locks, err := projectLockfiles(append([]string{file}, projects...))
+	if err != nil {
+		return err
+	}
+	if len(locks) == 0 {
+		return errPruneNoLockfiles
+	}
+
+	targets, err := pruneTargets(locks,
+		filepath.Join(PATHS.GopacksetPath, "src"),
+		filepath.Join(PATHS.GopackPath, storeDir))
+	if err != nil {
+		return err
+	}
+
+	verb := "Removing"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	var total int64
+	for _, t := range targets {
+		fmt.Fprintf(out, "%s: %s (%s)\n", verb, t.label, formatBytes(t.size))
+		total += t.size
+		if !*dryRun {
+			if err = os.RemoveAll(t.path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, project := range forgotten {
+		fmt.Fprintln(out, "Forgetting missing project:", project)
+	}
+
+	if *dryRun {
+		fmt.Fprintf(out, "Would free %s.\n", formatBytes(total))
+		return nil
+	}
+	fmt.Fprintf(out, "Freed %s.\n", formatBytes(total))
+
+	if len(forgotten) > 0 {
+		return updateConfig(func() {
+			var kept []string
+			for _, project := range config.Projects {
+				if !hasString(forgotten, project) {
+					kept = append(kept, project)
+				}
+			}
+			config.Projects = kept
+		})
+	}
+	return nil
+}
+
+// registerProject remembers a project by its packfile so that gp prune keeps
+// the packages its lockfile references.
+func registerProject(file string) error {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	if hasString(config.Projects, abs) {
+		return nil
+	}
+	return updateConfig(func() {
+		if !hasString(config.Projects, abs) {
+			config.Projects = append(config.Projects, abs)
+		}
+	})
+}
+
+// pruneProjects splits the registered projects into those whose packfile
+// still exists and those that have been removed.
+func pruneProjects() (projects, forgotten []string) {
+	for _, project := range config.Projects {
+		if _, err := os.Stat(project); os.IsNotExist(err) {
+			forgotten = append(forgotten, project)
+		} else {
+			projects = append(projects, project)
+		}
+	}
+	return projects, forgotten
+}
+
+// projectLockfiles loads the lockfiles of projects given by their packfiles,
+// skipping projects that don't have one.
+func projectLockfiles(files []string) ([]*lockfile, error) {
+	var locks []*lockfile
+	for _, file := range files {
+		lock, err := loadLockfile(lockfilePath(file))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+// pruneTargets finds the package directories in a packset's src directory and
+// the trees in a store that none of the lockfiles reference. Installed
+// packages the lockfiles don't record a hash for keep their tree in the store.
+func pruneTargets(locks []*lockfile, src, store string) ([]pruneTarget,
+	error) {
+
+	// names maps every referenced package to whether its hash is known.
+	names := make(map[string]bool)
+	hashes := make(map[string]bool)
+	for _, l := range locks {
+		for _, e := range l.Packages {
+			if len(e.Hash) > 0 {
+				hashes[e.Hash] = true
+				names[e.Name] = true
+			} else if !names[e.Name] {
+				names[e.Name] = false
+			}
+		}
+	}
+
+	var targets []pruneTarget
+	err := prunePackset(src, "", names, hashes, &targets)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(store)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, info := range infos {
+		hash := strings.Replace(info.Name(), "-", ":", 1)
+		if !info.IsDir() || hashes[hash] {
+			continue
+		}
+		dir := filepath.Join(store, info.Name())
+		size, err := treeSize(dir)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, pruneTarget{
+			path.Join(storeDir, info.Name()), dir, size,
+		})
+	}
+	return targets, nil
+}
+
+// prunePackset walks a packset directory, descending into directories that
+// lead to referenced packages and collecting everything else as a target.
+func prunePackset(dir, prefix string, names, hashes map[string]bool,
+	targets *[]pruneTarget) error {
+
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		name := path.Join(prefix, info.Name())
+		child := filepath.Join(dir, info.Name())
+
+		if hashed, ok := names[name]; ok {
+			if !hashed {
+				var all []string
+				for n := range names {
+					all = append(all, n)
+				}
+				hash, err := hashTree(child, nestedPackages(name, all))
+				if err != nil {
+					return err
+				}
+				hashes[hash] = true
+			}
+			continue
+		}
+		if info.IsDir() && leadsToPackage(names, name) {
+			err = prunePackset(child, name, names, hashes, targets)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		size, err := treeSize(child)
+		if err != nil {
+			return err
+		}
+		*targets = append(*targets, pruneTarget{name, child, size})
+	}
+	return nil
+}
+
+// leadsToPackage checks if a directory contains a referenced package.
+func leadsToPackage(names map[string]bool, dir string) bool {
+	for name := range names {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"github.com/aarondl/pack"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	. "testing"
+)
+
+func TestPrune_Targets(t *T) {
+	dir := mkTree(t, map[string]string{
+		"src/example.com/apple/apple.go":   "package apple",
+		"src/example.com/banana/banana.go": "package banana",
+		"src/example.com/old/old.go":       "package old",
+		"src/gone.org/x/x.go":              "package x",
+		"store/sha256-kept/a.go":           "package a",
+		"store/sha256-unused/b.go":         "package b",
+	})
+	defer os.RemoveAll(dir)
+
+	bananaHash, err := hashTree(filepath.Join(dir, "src/example.com/banana"), nil)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	bananaStore := filepath.Join(dir, "store", storePath("", bananaHash))
+	if err = os.MkdirAll(bananaStore, 0775); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	locks := []*lockfile{
+		{Packages: []*lockentry{
+			{Name: "example.com/apple", Version: "1.0.0", Hash: "sha256:kept"},
+		}},
+		{Packages: []*lockentry{
+			{Name: "example.com/banana", Version: "2.0.0"},
+		}},
+	}
+	targets, err := pruneTargets(locks, filepath.Join(dir, "src"),
+		filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var labels []string
+	for _, target := range targets {
+		labels = append(labels, target.label)
+		if target.size == 0 {
+			t.Error("Expected a size for:", target.label)
+		}
+	}
+	sort.Strings(labels)
+	expect := "example.com/old gone.org store/sha256-unused"
+	if got := strings.Join(labels, " "); got != expect {
+		t.Errorf("Expected targets %q, got %q", expect, got)
+	}
+}
+
+func TestPrune_Command(t *T) {
+	dir := mkTree(t, map[string]string{
+		"project/package.yaml": "name: root",
+	})
+	defer os.RemoveAll(dir)
+
+	var err error
+	PATHS, err = pack.NewPaths(filepath.Join(dir, "gopath"), DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = os.MkdirAll(PATHS.GopackPath, 0775); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	stale := filepath.Join(PATHS.GopacksetPath, "src", "example.com", "old")
+	if err = os.MkdirAll(stale, 0775); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	file := filepath.Join(dir, "project", PACKFILE)
+	var buf bytes.Buffer
+	if err = prunePackages(file, nil, &buf); err != errPruneNoLockfiles {
+		t.Error("Expected errPruneNoLockfiles, got:", err)
+	}
+
+	lock := &lockfile{Packages: []*lockentry{
+		{Name: "example.com/apple", Version: "1.0.0"},
+	}}
+	if err = lock.save(lockfilePath(file)); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	missing := filepath.Join(dir, "missing", PACKFILE)
+	config.Projects = []string{missing}
+	defer func() { config.Projects = nil }()
+
+	err = prunePackages(file, []string{"--dry-run"}, &buf)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if str := buf.String(); !strings.Contains(str,
+		"Would remove: example.com/old (0 B)") {
+
+		t.Error("Expected example.com/old to be listed, got:", str)
+	}
+	if _, err = os.Stat(stale); err != nil {
+		t.Error("Expected a dry run not to remove anything:", err)
+	}
+
+	buf.Reset()
+	if err = prunePackages(file, nil, &buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected the stale package to be removed, got:", err)
+	}
+	if len(config.Projects) != 0 {
+		t.Error("Expected the missing project to be forgotten, got:",
+			config.Projects)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errNoPublishTarget = errors.New("No registry or repository is " +
+		"configured to publish to, use -dir to publish to a directory.")
+	errNoArchivePackfile = errors.New(
+		"The archive does not contain a package.yaml.")
+)
+
+// publisher is a package source that new versions can be published to.
+type publisher interface {
+	Publish(string, *pack.Version, []byte) error
+}
+
+// packfileMismatchError is returned when a published archive's packfile is
+// unreadable or describes a different package or version than it's published
+// as.
+type packfileMismatchError string
+
+// Error explains what's wrong with the packfile.
+func (p packfileMismatchError) Error() string {
+	return "Invalid archive: " + string(p) + "."
+}
+
+// publishedError is returned when publishing a version that already exists.
+type publishedError string
+
+// Error names the version that already exists.
+func (p publishedError) Error() string {
+	return string(p) + " has already been published."
+}
+
+// publishPackage builds an archive of the package and publishes it to the
+// registry, the repository or the directory given by -dir.
+func publishPackage(file string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dir := flags.String("dir", "",
+		"Publish to a local repository directory instead of the registry.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	p, err := pack.ParsePackFile(file)
+	if err != nil {
+		return err
+	}
+	v, err := validatePack(p)
+	if err != nil {
+		return err
+	}
+
+	var pub publisher
+	switch {
+	case len(*dir) > 0:
+		pub = newLocalRepository(*dir)
+	case len(config.Registry) > 0:
+		creds, err := loadCredentials()
+		if err != nil {
+			return err
+		}
+		retry, err := newRetryPolicy(config.Fetch)
+		if err != nil {
+			return err
+		}
+		r := newRegistryClient(config.Registry)
+		r.creds = creds
+		r.retry = retry
+		r.client = retry.httpClient()
+		pub = r
+	case len(config.Repository) > 0:
+		pub = newLocalRepository(config.Repository)
+	default:
+		return errNoPublishTarget
+	}
+
+	archive, err := packageArchive(filepath.Dir(file))
+	if err != nil {
+		return err
+	}
+
+	if err = pub.Publish(p.ImportPath, v, archive); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Published %s %v (%d bytes)\n",
+		p.ImportPath, v, len(archive))
+	return err
+}
+
+// validatePack checks that a pack has everything needed to publish it and
+// returns its version.
+func validatePack(p *pack.Pack) (*pack.Version, error) {
+	var missing []string
+	if len(p.Name) == 0 {
+		missing = append(missing, "name")
+	}
+	if len(p.ImportPath) == 0 {
+		missing = append(missing, "importpath")
+	}
+	if len(p.Version) == 0 {
+		missing = append(missing, "version")
+	}
+	if len(p.License) == 0 {
+		missing = append(missing, "license")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s is missing: %s", PACKFILE,
+			strings.Join(missing, ", "))
+	}
+
+	v, err := pack.ParseVersion(p.Version)
+	if err != nil {
+		return nil, fmt.Errorf("%s has an invalid version %q: %v", PACKFILE,
+			p.Version, err)
+	}
+	return v, nil
+}
+
+// packageArchive builds the archive of a package's directory.
+func packageArchive(dir string) ([]byte, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = writeTarGz(dir, packageFilter(dir), &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// packageFilter excludes the files git ignores when the package is in a git
+// work tree. The packfile is always included.
+func packageFilter(dir string) archiveFilter {
+	files, err := runGit(dir, "ls-files", "-z", "--cached", "--others",
+		"--exclude-standard")
+	if err != nil {
+		return nil
+	}
+
+	tracked := make(map[string]bool)
+	for _, file := range strings.Split(files, "\x00") {
+		tracked[file] = true
+	}
+	return func(rel string, _ os.FileInfo) bool {
+		return rel == PACKFILE || tracked[rel]
+	}
+}
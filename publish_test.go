@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"github.com/aarondl/pack"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+)
+
+var testPackfile = "name: apple\nimportpath: example.com/apple\n" +
+	"version: 1.0.0\nlicense: MIT\n"
+
+func TestPublish_Validate(t *T) {
+	_, err := validatePack(&pack.Pack{Name: "apple"})
+	if err == nil || !strings.Contains(err.Error(),
+		"importpath, version, license") {
+
+		t.Error("Expected the missing fields to be listed, got:", err)
+	}
+
+	p := &pack.Pack{Name: "apple", ImportPath: "example.com/apple",
+		Version: "one", License: "MIT"}
+	if _, err = validatePack(p); err == nil {
+		t.Error("Expected an invalid version to fail.")
+	}
+
+	p.Version = "1.0.0"
+	if v, err := validatePack(p); err != nil || v.String() != "1.0.0" {
+		t.Error("Expected version 1.0.0, got:", v, err)
+	}
+}
+
+func TestPublish_Archive(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	dir := mkGitRepo(t, []string{"v1.0.0"}, []map[string]string{{
+		PACKFILE:     testPackfile,
+		"apple.go":   "package apple",
+		".gitignore": "secret.txt\n",
+	}})
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("shh"), 0664)
+	ioutil.WriteFile(filepath.Join(dir, "new.go"), []byte("package a"), 0664)
+
+	archive, err := packageArchive(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	dest := mkTree(t, nil)
+	defer os.RemoveAll(dest)
+	if err = extractTarGz(bytes.NewReader(archive), dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for _, file := range []string{PACKFILE, "apple.go", "new.go"} {
+		if _, err = os.Stat(filepath.Join(dest, file)); err != nil {
+			t.Error("Expected file to be archived:", file)
+		}
+	}
+	for _, file := range []string{"secret.txt", ".git"} {
+		if _, err = os.Stat(filepath.Join(dest, file)); err == nil {
+			t.Error("Did not expect file to be archived:", file)
+		}
+	}
+}
+
+func TestPublish_Local(t *T) {
+	dir := mkTree(t, map[string]string{
+		PACKFILE:   testPackfile,
+		"apple.go": "package apple",
+	})
+	defer os.RemoveAll(dir)
+	repo := mkTree(t, nil)
+	defer os.RemoveAll(repo)
+
+	var buf bytes.Buffer
+	file := filepath.Join(dir, PACKFILE)
+	if err := publishPackage(file, []string{"-dir", repo}, &buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	err := publishPackage(file, []string{"-dir", repo}, &buf)
+	if _, ok := err.(publishedError); !ok {
+		t.Error("Expected a published error, got:", err)
+	}
+
+	l := newLocalRepository(repo)
+	if vs := l.GetVersions("example.com/apple"); len(vs) != 1 {
+		t.Fatal("Expected a single version, got:", vs)
+	}
+	v := mkVers("1.0.0")[0]
+	if p := l.GetPack("example.com/apple", v); p.License != "MIT" {
+		t.Error("Expected the MIT license, got:", p.License)
+	}
+
+	dest := filepath.Join(repo, "dest")
+	if err = l.Fetch("example.com/apple", v, dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dest, "apple.go")); string(b) !=
+		"package apple" {
+
+		t.Error("Wrong contents fetched:", string(b))
+	}
+}
+
+func TestPublish_Registry(t *T) {
+	dir := mkTree(t, map[string]string{
+		PACKFILE:   testPackfile,
+		"apple.go": "package apple",
+	})
+	defer os.RemoveAll(dir)
+	repo := mkTree(t, nil)
+	defer os.RemoveAll(repo)
+
+	srv := httptest.NewServer(newRegistryServer(repo, true))
+	defer srv.Close()
+	readonly := httptest.NewServer(newRegistryServer(repo, false))
+	defer readonly.Close()
+
+	archive, err := packageArchive(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	v := mkVers("1.0.0")[0]
+
+	err = newRegistryClient(readonly.URL).Publish("example.com/apple", v,
+		archive)
+	if err == nil {
+		t.Error("Expected publishing to a read only server to fail.")
+	}
+
+	if err = newRegistryClient(srv.URL).Publish("example.com/apple", v,
+		archive); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	err = newRegistryClient(srv.URL).Publish("example.com/apple", v, archive)
+	if _, ok := err.(publishedError); !ok {
+		t.Error("Expected a published error, got:", err)
+	}
+
+	r := newRegistryClient(readonly.URL)
+	if p := r.GetPack("example.com/apple", v); p.License != "MIT" {
+		t.Error("Expected the MIT license, got:", p.License)
+	}
+	dest := filepath.Join(repo, "dest")
+	if err = r.Fetch("example.com/apple", v, dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = os.Stat(filepath.Join(dest, "apple.go")); err != nil {
+		t.Error("Expected apple.go to be fetched:", err)
+	}
+}
+
+func TestPublish_Mismatch(t *T) {
+	dir := mkTree(t, map[string]string{
+		PACKFILE: "name: banana\nimportpath: example.com/banana\n" +
+			"version: 9.9.9\nlicense: MIT\n",
+		"banana.go": "package banana",
+	})
+	defer os.RemoveAll(dir)
+	repo := mkTree(t, nil)
+	defer os.RemoveAll(repo)
+
+	srv := httptest.NewServer(newRegistryServer(repo, true))
+	defer srv.Close()
+
+	archive, err := packageArchive(dir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	v := mkVers("1.0.0")[0]
+
+	err = newLocalRepository(repo).Publish("example.com/apple", v, archive)
+	if _, ok := err.(packfileMismatchError); !ok {
+		t.Error("Expected a packfile mismatch, got:", err)
+	}
+
+	err = newRegistryClient(srv.URL).Publish("example.com/apple", v, archive)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Error("Expected a bad request, got:", err)
+	}
+	if vs := newLocalRepository(repo).GetVersions(
+		"example.com/apple"); len(vs) != 0 {
+
+		t.Error("Expected nothing to be published, got:", vs)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"io/ioutil"
+	"launchpad.net/goyaml"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	registryVersions = "versions"
+	registryArchive  = "archive.tar.gz"
+)
+
+// registryIndex is the version listing served by a registry.
+type registryIndex struct {
+	Versions []string `json:"versions"`
+}
+
+// registryClient is a versionProvider and fetcher backed by an HTTP registry.
+// The registry serves, relative to its base url:
+//
+//	<name>/versions                    A JSON object listing the versions.
+//	<name>/<version>/package.yaml      The packfile of a version.
+//	<name>/<version>/archive.tar.gz    The sources of a version.
+type registryClient struct {
+	failureLog
+	base     string
+	client   *http.Client
+	creds    *credentialStore
+	retry    *retryPolicy
+	versions map[string][]*pack.Version
+	packs    map[string]*pack.Pack
+}
+
+// newRegistryClient creates a client for the registry at a base url.
+func newRegistryClient(base string) *registryClient {
+	return &registryClient{
+		base:     strings.TrimRight(base, "/"),
+		client:   http.DefaultClient,
+		versions: make(map[string][]*pack.Version),
+		packs:    make(map[string]*pack.Pack),
+	}
+}
+
+// url builds the url of a registry resource from its path elements.
+func (r *registryClient) url(elems ...string) string {
+	return r.base + "/" + strings.Join(elems, "/")
+}
+
+// do sends a request to the registry with the credentials of its host.
+func (r *registryClient) do(req *http.Request) (*http.Response, error) {
+	if err := r.creds.authorize(req); err != nil {
+		return nil, err
+	}
+	return r.client.Do(req)
+}
+
+// get requests a registry resource and hands its body to read, retrying the
+// request and read when they fail temporarily. It returns false if the
+// resource doesn't exist.
+func (r *registryClient) get(url string, read func(io.Reader) error) (bool,
+	error) {
+
+	found := true
+	err := r.retry.do(func() error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := r.do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			found = true
+			return read(resp.Body)
+		case http.StatusNotFound:
+			found = false
+			return nil
+		}
+		return statusError("GET", url, resp)
+	})
+	return found, err
+}
+
+// GetVersions gets the versions of a package from the registry, highest first.
+func (r *registryClient) GetVersions(name string) []*pack.Version {
+	if vs, ok := r.versions[name]; ok {
+		return vs
+	}
+
+	var index registryIndex
+	url := r.url(name, registryVersions)
+	found, err := r.get(url, func(body io.Reader) error {
+		index = registryIndex{}
+		return json.NewDecoder(body).Decode(&index)
+	})
+	if err != nil || !found {
+		if err != nil {
+			r.fail(name, err)
+		}
+		return nil
+	}
+
+	var vs []*pack.Version
+	for _, version := range index.Versions {
+		v, err := pack.ParseVersion(version)
+		if err != nil {
+			r.fail(name, err)
+			return nil
+		}
+		vs = append(vs, v)
+	}
+	sort.Sort(byVersion(vs))
+
+	r.versions[name] = vs
+	return vs
+}
+
+// GetPack gets the packfile of a version of a package. A version without a
+// packfile gets an empty pack.
+func (r *registryClient) GetPack(name string, v *pack.Version) *pack.Pack {
+	key := name + " " + v.String()
+	if p, ok := r.packs[key]; ok {
+		return p
+	}
+
+	p := new(pack.Pack)
+	url := r.url(name, v.String(), PACKFILE)
+	_, err := r.get(url, func(body io.Reader) error {
+		all, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		*p = pack.Pack{}
+		return goyaml.Unmarshal(all, p)
+	})
+	if err != nil {
+		r.fail(name, err)
+	}
+
+	r.packs[key] = p
+	return p
+}
+
+// GetGraph gets the dependency graph of a version of a package.
+func (r *registryClient) GetGraph(name string, v *pack.Version) *depgraph {
+	graph, err := newPackGraph(r.GetPack(name, v))
+	if err != nil {
+		r.fail(name, err)
+		graph = &depgraph{head: &depnode{d: &pack.Dependency{Name: name}}}
+	}
+	graph.head.v = v
+	return graph
+}
+
+// Publish uploads the archive of a version of a package to the registry. Unlike
+// other requests it isn't retried, an upload that failed may still have been
+// stored.
+func (r *registryClient) Publish(name string, v *pack.Version,
+	archive []byte) error {
+
+	if containsVersion(r.GetVersions(name), v) {
+		return publishedError(name + " " + v.String())
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	url := r.url(name, v.String(), registryArchive)
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+
+	resp, err := r.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		return publishedError(name + " " + v.String())
+	case resp.StatusCode/100 != 2:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := statusError("PUT", url, resp)
+		err.err = fmt.Errorf("%v: %s", err.err,
+			strings.TrimSpace(string(msg)))
+		return err
+	}
+	return nil
+}
+
+// Fetch downloads the archive of a version of a package and extracts it into
+// dest, replacing anything that was there before.
+func (r *registryClient) Fetch(name string, v *pack.Version,
+	dest string) error {
+
+	url := r.url(name, v.String(), registryArchive)
+	found, err := r.get(url, func(body io.Reader) error {
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+		return extractTarGz(body, dest)
+	})
+	if err == nil && !found {
+		err = &fetchError{kind: fetchNotFound, attempts: 1,
+			err: fmt.Errorf("GET %s: %d Not Found", redact(url),
+				http.StatusNotFound)}
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+// mkTarGz creates a gzipped tar archive of regular files.
+func mkTarGz(t *T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, contents := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		tw.Write([]byte(contents))
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+// mkRegistry serves the given paths over http.
+func mkRegistry(paths map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/broken/versions" {
+				http.Error(w, "oops", http.StatusInternalServerError)
+				return
+			}
+			if b, ok := paths[r.URL.Path]; ok {
+				w.Write(b)
+				return
+			}
+			http.NotFound(w, r)
+		},
+	))
+}
+
+func TestRegistry(t *T) {
+	srv := mkRegistry(map[string][]byte{
+		"/example.com/apple/versions": []byte(
+			`{"versions": ["0.1.0", "1.1.0", "1.0.0"]}`),
+		"/example.com/apple/1.0.0/package.yaml": []byte(
+			"name: apple\nlicense: MIT\n" +
+				"dependencies:\n- example.com/banana ~1.0.0\n"),
+		"/example.com/apple/1.0.0/archive.tar.gz": mkTarGz(t,
+			map[string]string{
+				"apple.go": "package apple",
+				"sub/s.go": "package sub",
+			},
+		),
+	})
+	defer srv.Close()
+
+	r := newRegistryClient(srv.URL + "/")
+	name := "example.com/apple"
+
+	vs := r.GetVersions(name)
+	expect := mkVers("1.1.0", "1.0.0", "0.1.0")
+	if len(vs) != len(expect) {
+		t.Fatal("Expected versions:", expect, "got:", vs)
+	}
+	for i := range vs {
+		if vs[i].String() != expect[i].String() {
+			t.Fatal("Expected versions:", expect, "got:", vs)
+		}
+	}
+	if vs = r.GetVersions("example.com/missing"); len(vs) != 0 {
+		t.Error("Expected no versions, got:", vs)
+	}
+
+	graph := r.GetGraph(name, expect[1])
+	if len(graph.head.kids) != 1 ||
+		graph.head.kids[0].d.Name != "example.com/banana" {
+
+		t.Error("Expected a dependency on banana, got:", graph)
+	}
+	if p := r.GetPack(name, expect[1]); p.License != "MIT" {
+		t.Error("Expected the MIT license, got:", p.License)
+	}
+	if graph = r.GetGraph(name, expect[0]); len(graph.head.kids) != 0 {
+		t.Error("Expected no dependencies without a packfile, got:", graph)
+	}
+	if err := r.Err(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	dest := mkTree(t, nil)
+	defer os.RemoveAll(dest)
+	if err := r.Fetch(name, expect[1], dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dest, "sub", "s.go")); string(b) !=
+		"package sub" {
+
+		t.Error("Wrong contents fetched:", string(b))
+	}
+	if err := r.Fetch(name, expect[0], dest); err == nil {
+		t.Error("Expected an error for a missing archive.")
+	}
+
+	r.GetVersions("broken")
+	if r.Err() == nil {
+		t.Error("Expected a server error to be recorded.")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+)
+
+var (
+	errNoReportFile = errors.New("An output file must be given with --html.")
+)
+
+// reportnode is a node in the dependency tree of a report.
+type reportnode struct {
+	Name        string
+	Version     string
+	Constraints string
+	Kids        []*reportnode
+}
+
+// reportpackage is a row in the package table of a report.
+type reportpackage struct {
+	Name     string
+	Version  string
+	License  string
+	Homepage string
+}
+
+// reportlicense is a row in the license summary of a report.
+type reportlicense struct {
+	License  string
+	Packages []string
+}
+
+// report is everything rendered into an html report.
+type report struct {
+	Name     string
+	Tree     *reportnode
+	Packages []reportpackage
+	Licenses []reportlicense
+	Conflict string
+}
+
+// byLicense sorts license summaries by name.
+type byLicense []reportlicense
+
+func (b byLicense) Len() int           { return len(b) }
+func (b byLicense) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byLicense) Less(i, j int) bool { return b[i].License < b[j].License }
+
+// byPackage sorts package rows by name.
+type byPackage []reportpackage
+
+func (b byPackage) Len() int           { return len(b) }
+func (b byPackage) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byPackage) Less(i, j int) bool { return b[i].Name < b[j].Name }
+
+// writeReport solves the packfile's dependencies and writes a self contained
+// html report to the file given by --html. A failed resolution still produces
+// a report explaining the conflict, but the error is returned afterwards.
+func writeReport(file string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	flags.SetOutput(out)
+	html := flags.String("html", "", "File to write the html report to.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(*html) == 0 {
+		return errNoReportFile
+	}
+
+	r, solveErr := resolvePackage(file)
+	if r == nil {
+		return solveErr
+	}
+
+	f, err := os.Create(*html)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = newReport(r, solveErr).write(f); err != nil {
+		return err
+	}
+	return solveErr
+}
+
+// newReport gathers the data for a report from a resolution.
+func newReport(r *resolution, solveErr error) *report {
+	rep := &report{Name: r.graph.head.d.Name}
+	if solveErr != nil {
+		rep.Conflict = solveErr.Error()
+	}
+
+	var parents []*reportnode
+	depgraphWalk(r.graph.head, nil, 0, 0, false,
+		func(n, _ *depnode, depth uint, _ uint64, _ bool) {
+			rn := &reportnode{
+				Name:        n.d.Name,
+				Constraints: constraintString(n.d),
+			}
+			if n.v != nil {
+				rn.Version = n.v.String()
+			}
+
+			parents = append(parents[:depth], rn)
+			if depth == 0 {
+				rep.Tree = rn
+			} else {
+				parent := parents[depth-1]
+				parent.Kids = append(parent.Kids, rn)
+			}
+		},
+	)
+
+	licenses := make(map[string][]string)
+	for name, act := range r.acts {
+		row := reportpackage{Name: name, Version: act.version.String()}
+		if p := r.getPack(name, act.version); p != nil {
+			row.License, row.Homepage = p.License, p.Homepage
+		}
+		rep.Packages = append(rep.Packages, row)
+
+		license := row.License
+		if len(license) == 0 {
+			license = "Unknown"
+		}
+		licenses[license] = append(licenses[license], name)
+	}
+	sort.Sort(byPackage(rep.Packages))
+
+	for license, names := range licenses {
+		sort.Strings(names)
+		rep.Licenses = append(rep.Licenses, reportlicense{license, names})
+	}
+	sort.Sort(byLicense(rep.Licenses))
+
+	return rep
+}
+
+// write renders the report as html.
+func (rep *report) write(out io.Writer) error {
+	return reportTemplate.Execute(out, rep)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - Dependency Report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.2em; border-bottom: 1px solid #ccc; }
+ul.tree, ul.tree ul { list-style: none; padding-left: 1.2em; }
+ul.tree summary { cursor: pointer; }
+.version { color: #070; }
+.constraints { color: #777; }
+.conflict { background: #fee; border: 1px solid #c00; padding: 1em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }
+th { border-bottom: 1px solid #ccc; }
+input { margin-bottom: 0.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Conflict}}
+<h2>Conflict</h2>
+<pre class="conflict">{{.Conflict}}</pre>
+{{end}}
+<h2>Dependencies</h2>
+<ul class="tree">{{template "node" .Tree}}</ul>
+<h2>Packages</h2>
+<input id="search" type="search" placeholder="Search packages" oninput="filter(this.value)">
+<table id="packages">
+<thead><tr><th>Package</th><th>Version</th><th>License</th><th>Homepage</th></tr></thead>
+<tbody>
+{{range .Packages}}<tr><td>{{.Name}}</td><td>{{.Version}}</td><td>{{.License}}</td><td>{{if .Homepage}}<a href="{{.Homepage}}">{{.Homepage}}</a>{{end}}</td></tr>
+{{end}}</tbody>
+</table>
+<h2>Licenses</h2>
+<table>
+<thead><tr><th>License</th><th>Count</th><th>Packages</th></tr></thead>
+<tbody>
+{{range .Licenses}}<tr><td>{{.License}}</td><td>{{len .Packages}}</td><td>{{range $i, $p := .Packages}}{{if $i}}, {{end}}{{$p}}{{end}}</td></tr>
+{{end}}</tbody>
+</table>
+<script>
+function filter(text) {
+	text = text.toLowerCase();
+	var rows = document.getElementById("packages").tBodies[0].rows;
+	for (var i = 0; i < rows.length; i++) {
+		var match = rows[i].textContent.toLowerCase().indexOf(text) >= 0;
+		rows[i].style.display = match ? "" : "none";
+	}
+}
+</script>
+</body>
+</html>
+{{define "node"}}<li>{{if .Kids}}<details open><summary>{{template "label" .}}</summary><ul>{{range .Kids}}{{template "node" .}}{{end}}</ul></details>{{else}}{{template "label" .}}{{end}}</li>{{end}}
+{{define "label"}}{{.Name}}{{if .Version}} <span class="version">{{.Version}}</span>{{end}}{{if .Constraints}} <span class="constraints">({{.Constraints}})</span>{{end}}{{end}}`))
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aarondl/pack"
+	"strings"
+	. "testing"
+)
+
+func TestReport(t *T) {
+	vp := &testpp{testvp: repository, packs: map[string]*pack.Pack{
+		"apple":  &pack.Pack{License: "MIT", Homepage: "http://apple.com"},
+		"banana": &pack.Pack{License: "MIT"},
+	}}
+	r := &resolution{graph: mkGraph(`
+	root 1.0.0
+	-apple 1.0.0
+	-banana 1.0.0
+	`), vp: vp}
+
+	var err error
+	if r.acts, err = r.graph.solve(vp); err != nil {
+		t.Fatal("Solution was not found:", err)
+	}
+
+	rep := newReport(r, nil)
+	if rep.Tree == nil || rep.Tree.Name != "root" || len(rep.Tree.Kids) != 2 {
+		t.Error("Tree was not built correctly:", rep.Tree)
+	}
+	if len(rep.Packages) != 2 || rep.Packages[0].Name != "apple" {
+		t.Error("Packages were not listed correctly:", rep.Packages)
+	}
+	if len(rep.Licenses) != 1 || len(rep.Licenses[0].Packages) != 2 {
+		t.Error("Licenses were not summarized correctly:", rep.Licenses)
+	}
+
+	var buf bytes.Buffer
+	if err = rep.write(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	html := buf.String()
+	for _, exp := range []string{`<details open><summary>root`,
+		`<td>apple</td><td>1.0.0</td><td>MIT</td>`, `http://apple.com`} {
+
+		if !strings.Contains(html, exp) {
+			t.Errorf("Expected report to contain %q, got:\n%s", exp, html)
+		}
+	}
+	if strings.Contains(html, `class="conflict"`) {
+		t.Error("Did not expect a conflict section.")
+	}
+}
+
+func TestReport_Conflict(t *T) {
+	r := &resolution{graph: mkGraph(`
+	root 1.0.0
+	-apple 1.0.0
+	`), vp: &repository}
+
+	var buf bytes.Buffer
+	rep := newReport(r, errors.New("apple & banana disagree"))
+	if err := rep.write(&buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if html := buf.String(); !strings.Contains(html,
+		`<pre class="conflict">apple &amp; banana disagree</pre>`) {
+
+		t.Error("Expected an escaped conflict section, got:\n", html)
+	}
+}
+
+func TestReport_NoFile(t *T) {
+	var buf bytes.Buffer
+	if err := writeReport(PACKFILE, nil, &buf); err != errNoReportFile {
+		t.Error("Expected errNoReportFile, got:", err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/aarondl/pack"
 	"log"
@@ -9,6 +10,13 @@ import (
 
 const (
 	initialStackSize = 20
+	// maxSolveSteps bounds how long solve searches before giving up.
+	maxSolveSteps = 1000000
+)
+
+var (
+	errSolveSteps = errors.New(
+		"Gave up solving the dependencies, the search took too long.")
 )
 
 // versionProvider allows us to look up available versions for each package
@@ -60,6 +68,7 @@ solve a dependency graph. This algorithm is a depth first search with
 backjumping to resolve conflicts.
 */
 func (g *depgraph) solve(vp versionProvider) (map[string]*activation, error) {
+	g.backtracks = 0
 	if len(g.head.kids) == 0 {
 		return nil, nil
 	}
@@ -88,7 +97,10 @@ func (g *depgraph) solve(vp versionProvider) (map[string]*activation, error) {
 		parent = sn.parent
 	}
 
-	for i := 0; i < 100; i++ {
+	for step := 0; ; step++ {
+		if step == maxSolveSteps {
+			return nil, errSolveSteps
+		}
 		name := current.d.Name
 		if verbose {
 			log.Println("Current:", current.d)
@@ -212,6 +224,7 @@ func (g *depgraph) solve(vp versionProvider) (map[string]*activation, error) {
 						)
 				}
 				setState(st.stacknode)
+				g.backtracks++
 				vi++
 				kid = 0
 				stack = st.stack
@@ -225,6 +238,7 @@ func (g *depgraph) solve(vp versionProvider) (map[string]*activation, error) {
 
 			// We can still climb the stack, try it.
 			setState(&stack[len(stack)-1])
+			g.backtracks++
 			stack = stack[:len(stack)-1]
 			vi++
 			kid = 0
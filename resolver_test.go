@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/aarondl/pack"
 	. "testing"
 )
@@ -262,3 +264,23 @@ func TestSolver_Backjumpheaven(t *T) {
 		t.Error(backjumpHeaven.String())
 	}
 }
+
+func TestSolver_Large(t *T) {
+	var chain bytes.Buffer
+	chain.WriteString("root 1.0.0\n")
+	vp := &testvp{make(map[string][]*depgraph)}
+	for i := 0; i < 200; i++ {
+		name := fmt.Sprintf("p%d", i)
+		fmt.Fprintf(&chain, "-%s\n", name)
+		vp.graphs[name] = []*depgraph{mkGraph(name + " 1.0.0")}
+	}
+	large := mkGraph(chain.String())
+
+	deps, err := large.solve(vp)
+	if err != nil {
+		t.Fatal("Solution was not found:", err)
+	}
+	if len(deps) != 200 {
+		t.Error("Expected every package to be activated, got:", len(deps))
+	}
+}
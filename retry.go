@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFetchTimeout = 5 * time.Minute
+	defaultFetchRetries = 3
+	defaultFetchBackoff = 500 * time.Millisecond
+	maxFetchBackoff     = 30 * time.Second
+)
+
+// fetchErrorKind classifies why a fetch failed.
+type fetchErrorKind int
+
+const (
+	fetchFailed fetchErrorKind = iota
+	fetchNotFound
+	fetchUnauthorized
+	fetchTransient
+)
+
+// fetchErrorKinds describe each kind of fetch error.
+var fetchErrorKinds = map[fetchErrorKind]string{
+	fetchFailed:       "Fetch failed",
+	fetchNotFound:     "Not found",
+	fetchUnauthorized: "Authentication failed",
+	fetchTransient:    "Temporary failure",
+}
+
+// fetchError is a fetch that failed for a known reason.
+type fetchError struct {
+	kind     fetchErrorKind
+	attempts int
+	err      error
+}
+
+// Error describes the kind of failure, the failure and how often it was
+// attempted.
+func (f *fetchError) Error() string {
+	msg := fmt.Sprintf("%s: %v", fetchErrorKinds[f.kind], f.err)
+	if f.attempts > 1 {
+		msg += fmt.Sprintf(" (after %d attempts)", f.attempts)
+	}
+	return msg
+}
+
+// statusError creates the error for an unexpected http response.
+func statusError(method, url string, resp *http.Response) *fetchError {
+	kind := fetchFailed
+	switch code := resp.StatusCode; {
+	case code == http.StatusNotFound || code == http.StatusGone:
+		kind = fetchNotFound
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		kind = fetchUnauthorized
+	case code == http.StatusRequestTimeout ||
+		code == http.StatusTooManyRequests || code/100 == 5:
+		kind = fetchTransient
+	}
+	return &fetchError{
+		kind: kind,
+		err:  fmt.Errorf("%s %s: %s", method, redact(url), resp.Status),
+	}
+}
+
+// gitErrorKinds map what git writes when it fails to the kind of failure.
+var gitErrorKinds = []struct {
+	kind     fetchErrorKind
+	messages []string
+}{
+	{fetchUnauthorized, []string{
+		"authentication failed", "could not read username",
+		"could not read password", "permission denied", "returned error: 401",
+		"returned error: 403",
+	}},
+	{fetchNotFound, []string{
+		"repository not found", "does not exist", "returned error: 404",
+		"not found",
+	}},
+	{fetchTransient, []string{
+		"could not resolve host", "timed out", "connection reset",
+		"connection refused", "early eof", "the remote end hung up",
+		"returned error: 5", "temporary failure", "transfer closed",
+	}},
+}
+
+// classifyGit classifies an error of a git command talking to a remote.
+func classifyGit(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.ToLower(err.Error())
+	for _, k := range gitErrorKinds {
+		for _, m := range k.messages {
+			if strings.Contains(msg, m) {
+				return &fetchError{kind: k.kind, err: err}
+			}
+		}
+	}
+	return err
+}
+
+// classifyFetchError gets the kind of a fetch error. Network errors and
+// connections closed early are transient.
+func classifyFetchError(err error) fetchErrorKind {
+	switch e := err.(type) {
+	case *fetchError:
+		return e.kind
+	case *url.Error:
+		return classifyFetchError(e.Err)
+	case net.Error:
+		return fetchTransient
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return fetchTransient
+	}
+	return fetchFailed
+}
+
+// retryPolicy retries transient fetch failures with exponential backoff and
+// jitter, and bounds how long each attempt takes. A nil policy attempts once
+// without a timeout.
+type retryPolicy struct {
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	sleep   func(time.Duration)
+}
+
+// newRetryPolicy creates a retry policy from the configuration, using defaults
+// for anything that isn't configured.
+func newRetryPolicy(p *FetchPolicy) (*retryPolicy, error) {
+	r := &retryPolicy{
+		timeout: defaultFetchTimeout,
+		retries: defaultFetchRetries,
+		backoff: defaultFetchBackoff,
+		sleep:   time.Sleep,
+	}
+	if p == nil {
+		return r, nil
+	}
+
+	var err error
+	if len(p.Timeout) > 0 {
+		if r.timeout, err = time.ParseDuration(p.Timeout); err != nil {
+			return nil, fmt.Errorf("Invalid fetch timeout: %v", err)
+		}
+	}
+	if len(p.Backoff) > 0 {
+		if r.backoff, err = time.ParseDuration(p.Backoff); err != nil {
+			return nil, fmt.Errorf("Invalid fetch backoff: %v", err)
+		}
+	}
+	if p.Retries != nil {
+		r.retries = *p.Retries
+	}
+	return r, nil
+}
+
+// attemptTimeout gets how long a single attempt may take, zero if unbounded.
+func (r *retryPolicy) attemptTimeout() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return r.timeout
+}
+
+// httpClient creates an http client whose requests time out after the
+// policy's attempt timeout.
+func (r *retryPolicy) httpClient() *http.Client {
+	if r.attemptTimeout() == 0 {
+		return http.DefaultClient
+	}
+	return &http.Client{Timeout: r.timeout}
+}
+
+// do runs an attempt until it succeeds, fails in a way that isn't transient or
+// runs out of retries. Classified failures are returned as a fetchError, other
+// errors are returned as is.
+func (r *retryPolicy) do(attempt func() error) error {
+	for i := 0; ; i++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		kind := classifyFetchError(err)
+		if kind != fetchTransient || r == nil || i >= r.retries {
+			if fe, ok := err.(*fetchError); ok {
+				fe.attempts = i + 1
+				return fe
+			} else if kind != fetchFailed {
+				return &fetchError{kind, i + 1, err}
+			}
+			return err
+		}
+		r.sleep(r.delay(i))
+	}
+}
+
+// delay gets how long to wait before a retry: the backoff doubled for every
+// retry before it, capped, and randomized between half of that and all of it
+// so that parallel fetches don't retry in lockstep.
+func (r *retryPolicy) delay(retry int) time.Duration {
+	if r.backoff <= 0 {
+		return 0
+	}
+	d := r.backoff << uint(retry)
+	if d > maxFetchBackoff || d <= 0 {
+		d = maxFetchBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
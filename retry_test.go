@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	. "testing"
+	"time"
+)
+
+// testRetryPolicy creates a policy that records its delays instead of
+// sleeping.
+func testRetryPolicy(retries int, slept *[]time.Duration) *retryPolicy {
+	return &retryPolicy{
+		retries: retries,
+		backoff: 100 * time.Millisecond,
+		sleep: func(d time.Duration) {
+			*slept = append(*slept, d)
+		},
+	}
+}
+
+func TestRetry_Classify(t *T) {
+	tests := []struct {
+		err  error
+		kind fetchErrorKind
+	}{
+		{errors.New("boom"), fetchFailed},
+		{io.ErrUnexpectedEOF, fetchTransient},
+		{&fetchError{kind: fetchNotFound}, fetchNotFound},
+		{classifyGit(errors.New("fatal: Authentication failed for x")),
+			fetchUnauthorized},
+		{classifyGit(errors.New("fatal: repository 'x' not found")),
+			fetchNotFound},
+		{classifyGit(errors.New("fatal: Could not resolve host: x")),
+			fetchTransient},
+		{classifyGit(errors.New("git clone: timed out after 1s: ")),
+			fetchTransient},
+	}
+
+	for i, test := range tests {
+		if kind := classifyFetchError(test.err); kind != test.kind {
+			t.Errorf("%d) Expected kind %d, got: %d", i, test.kind, kind)
+		}
+	}
+}
+
+func TestRetry_Status(t *T) {
+	tests := []struct {
+		code int
+		kind fetchErrorKind
+	}{
+		{http.StatusNotFound, fetchNotFound},
+		{http.StatusUnauthorized, fetchUnauthorized},
+		{http.StatusForbidden, fetchUnauthorized},
+		{http.StatusTooManyRequests, fetchTransient},
+		{http.StatusServiceUnavailable, fetchTransient},
+		{http.StatusBadRequest, fetchFailed},
+	}
+
+	for i, test := range tests {
+		resp := &http.Response{
+			StatusCode: test.code,
+			Status: fmt.Sprintf("%d %s", test.code,
+				http.StatusText(test.code)),
+		}
+		err := statusError("GET", "https://u:p@example.com/x", resp)
+		if err.kind != test.kind {
+			t.Errorf("%d) Expected kind %d, got: %d", i, test.kind, err.kind)
+		}
+		if strings.Contains(err.Error(), "u:p") {
+			t.Errorf("%d) Expected the password to be redacted, got: %v", i,
+				err)
+		}
+	}
+}
+
+func TestRetry_Do(t *T) {
+	var slept []time.Duration
+	r := testRetryPolicy(3, &slept)
+
+	attempts := 0
+	err := r.do(func() error {
+		attempts++
+		if attempts < 3 {
+			return &fetchError{kind: fetchTransient, err: errors.New("503")}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	if attempts != 3 || len(slept) != 2 {
+		t.Error("Expected 3 attempts and 2 delays, got:", attempts, slept)
+	}
+
+	slept, attempts = nil, 0
+	err = r.do(func() error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	})
+	if fe, ok := err.(*fetchError); !ok || fe.kind != fetchTransient ||
+		fe.attempts != 4 || attempts != 4 {
+
+		t.Error("Expected a transient error after 4 attempts, got:", err)
+	}
+	if !strings.Contains(err.Error(), "after 4 attempts") {
+		t.Error("Expected the attempts in the error, got:", err)
+	}
+
+	slept, attempts = nil, 0
+	err = r.do(func() error {
+		attempts++
+		return &fetchError{kind: fetchNotFound, err: errors.New("404")}
+	})
+	if fe, ok := err.(*fetchError); !ok || fe.kind != fetchNotFound ||
+		attempts != 1 || len(slept) != 0 {
+
+		t.Error("Expected not found to fail without retrying, got:", err)
+	}
+
+	plain := errors.New("bad archive")
+	if err = r.do(func() error { return plain }); err != plain {
+		t.Error("Expected unclassified errors to be returned as is, got:",
+			err)
+	}
+
+	var nilPolicy *retryPolicy
+	attempts = 0
+	nilPolicy.do(func() error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	})
+	if attempts != 1 {
+		t.Error("Expected a nil policy to attempt once, got:", attempts)
+	}
+}
+
+func TestRetry_Delay(t *T) {
+	r := &retryPolicy{backoff: 100 * time.Millisecond}
+	for i := 0; i < 20; i++ {
+		want := r.backoff << uint(i)
+		if want > maxFetchBackoff || want <= 0 {
+			want = maxFetchBackoff
+		}
+		if d := r.delay(i); d < want/2 || d > want {
+			t.Errorf("%d) Expected a delay between %v and %v, got: %v", i,
+				want/2, want, d)
+		}
+	}
+}
+
+func TestRetry_Policy(t *T) {
+	retries := 0
+	r, err := newRetryPolicy(&FetchPolicy{
+		Timeout: "30s", Retries: &retries, Backoff: "1s",
+	})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if r.timeout != 30*time.Second || r.retries != 0 ||
+		r.backoff != time.Second {
+
+		t.Error("Expected the configured policy, got:", r)
+	}
+
+	if r, err = newRetryPolicy(nil); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if r.timeout != defaultFetchTimeout || r.retries != defaultFetchRetries {
+		t.Error("Expected the default policy, got:", r)
+	}
+
+	if _, err = newRetryPolicy(&FetchPolicy{Timeout: "soon"}); err == nil {
+		t.Error("Expected an error for an invalid timeout")
+	}
+}
+
+func TestRetry_Registry(t *T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) < 3 {
+				http.Error(w, "Busy", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"versions": ["1.0.0", "1.1.0"]}`)
+		},
+	))
+	defer srv.Close()
+
+	var slept []time.Duration
+	r := newRegistryClient(srv.URL)
+	r.retry = testRetryPolicy(3, &slept)
+	if vs := r.GetVersions("example.com/apple"); len(vs) != 2 {
+		t.Error("Expected the versions after retrying, got:", r.Err())
+	}
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Error("Expected 3 requests, got:", requests)
+	}
+
+	r = newRegistryClient(srv.URL)
+	r.retry = testRetryPolicy(0, &slept)
+	atomic.StoreInt32(&requests, 0)
+	if vs := r.GetVersions("example.com/apple"); len(vs) != 0 {
+		t.Error("Expected no versions without retries, got:", vs)
+	}
+	if fe, ok := r.Err().(*fetchError); !ok || fe.kind != fetchTransient {
+		t.Error("Expected a transient error, got:", r.Err())
+	}
+}
+
+func TestRetry_Publish(t *T) {
+	var puts int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "PUT" {
+				fmt.Fprint(w, `{"versions": []}`)
+				return
+			}
+			atomic.AddInt32(&puts, 1)
+			http.Error(w, "Busy", http.StatusServiceUnavailable)
+		},
+	))
+	defer srv.Close()
+
+	var slept []time.Duration
+	r := newRegistryClient(srv.URL)
+	r.retry = testRetryPolicy(3, &slept)
+	v := mkVers("1.0.0")[0]
+	if err := r.Publish("example.com/apple", v, nil); err == nil {
+		t.Error("Expected an error")
+	}
+	if atomic.LoadInt32(&puts) != 1 {
+		t.Error("Expected the upload not to be retried, got:", puts)
+	}
+}
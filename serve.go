@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultServeAddr   = "localhost:8080"
+	maxPublishSize     = 64 << 20
+	maxCachedResources = 64
+)
+
+var (
+	errNoServeDir = errors.New(
+		"A directory to serve must be given or configured as the repository.")
+)
+
+// cachedResource is a generated response and the fingerprint of what it was
+// generated from.
+type cachedResource struct {
+	fingerprint string
+	body        []byte
+}
+
+// registryServer serves a local repository using the protocol spoken by
+// registryClient. Version listings and archives are generated on demand, the
+// most recently generated ones are cached until the directory they came from
+// changes. New versions can be uploaded when publishing is enabled.
+type registryServer struct {
+	root    string
+	publish bool
+	mu      sync.Mutex
+	cache   map[string]cachedResource
+	// cachedKeys holds the keys of the cache, oldest first.
+	cachedKeys []string
+}
+
+// newRegistryServer creates a server for a local repository directory.
+func newRegistryServer(root string, publish bool) *registryServer {
+	return &registryServer{
+		root:    root,
+		publish: publish,
+		cache:   make(map[string]cachedResource),
+	}
+}
+
+// repo creates a view of the repository for a single request.
+func (s *registryServer) repo() *localRepository {
+	return newLocalRepository(s.root)
+}
+
+// serveRegistry serves a local repository over http until it fails. Uploads
+// aren't authenticated, so by default only this machine can connect.
+func serveRegistry(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(out)
+	addr := flags.String("addr", defaultServeAddr,
+		"Address to listen on, only this machine can connect by default.")
+	publish := flags.Bool("publish", false, "Allow new versions to be uploaded.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root := config.Repository
+	if flags.NArg() > 0 {
+		root = flags.Arg(0)
+	}
+	if len(root) == 0 {
+		return errNoServeDir
+	}
+
+	fmt.Fprintf(out, "Serving %s on %s\n", root, *addr)
+	return http.ListenAndServe(*addr, newRegistryServer(root, *publish))
+}
+
+// ServeHTTP routes a request to the version listing, packfile or archive of a
+// package.
+func (s *registryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	publishing := s.publish && r.Method == "PUT"
+	if r.Method != "GET" && r.Method != "HEAD" && !publishing {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clean := path.Clean("/" + r.URL.Path)
+	if clean != r.URL.Path || strings.Contains(clean, "/.") {
+		http.NotFound(w, r)
+		return
+	}
+	dir, resource := path.Split(strings.TrimPrefix(clean, "/"))
+	dir = strings.TrimSuffix(dir, "/")
+	if len(dir) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if resource == registryVersions && !publishing {
+		s.serveVersions(w, r, dir)
+		return
+	}
+
+	name, version := path.Split(dir)
+	name = strings.TrimSuffix(name, "/")
+	v, err := pack.ParseVersion(version)
+	if err != nil || len(name) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if publishing {
+		if resource != registryArchive {
+			http.NotFound(w, r)
+			return
+		}
+		s.servePublish(w, r, name, v)
+		return
+	}
+
+	vdir, err := s.repo().versionDir(name, v)
+	if err != nil {
+		s.serveBody(w, r, nil, err, "")
+		return
+	}
+
+	switch resource {
+	case PACKFILE:
+		http.ServeFile(w, r, filepath.Join(vdir, PACKFILE))
+	case registryArchive:
+		s.serveArchive(w, r, dir, vdir)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// cached gets a generated resource, regenerating it if the fingerprint of what
+// it's generated from has changed since it was cached. Once the cache is full
+// the oldest resource is dropped.
+func (s *registryServer) cached(key, fingerprint string,
+	generate func() ([]byte, error)) ([]byte, error) {
+
+	s.mu.Lock()
+	res, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && res.fingerprint == fingerprint {
+		return res.body, nil
+	}
+
+	body, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cache[key]; !ok {
+		if len(s.cachedKeys) >= maxCachedResources {
+			delete(s.cache, s.cachedKeys[0])
+			s.cachedKeys = s.cachedKeys[1:]
+		}
+		s.cachedKeys = append(s.cachedKeys, key)
+	}
+	s.cache[key] = cachedResource{fingerprint, body}
+	return body, nil
+}
+
+// treeFingerprint summarizes the names, modes, sizes and modification times
+// of the files in a directory, so that any file being rewritten changes it.
+func treeFingerprint(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%v\x00%d\x00%d\n", filepath.ToSlash(rel),
+			info.Mode(), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listingFingerprint summarizes the names of the directories in a package's
+// directory, which are all its version listing depends on.
+func listingFingerprint(dir string) (string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, info := range infos {
+		if info.IsDir() {
+			fmt.Fprintf(h, "%s\n", info.Name())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// serveVersions serves the version listing of a package, cached until a
+// version is added or removed.
+func (s *registryServer) serveVersions(w http.ResponseWriter, r *http.Request,
+	name string) {
+
+	dir := filepath.Join(s.root, filepath.FromSlash(name))
+	fingerprint, err := listingFingerprint(dir)
+	if err != nil {
+		s.serveBody(w, r, nil, err, "")
+		return
+	}
+
+	key := name + "/" + registryVersions
+	body, err := s.cached(key, fingerprint, func() ([]byte, error) {
+		var index registryIndex
+		index.Versions = []string{}
+		repo := s.repo()
+		for _, v := range repo.GetVersions(name) {
+			index.Versions = append(index.Versions, v.String())
+		}
+		if err := repo.Err(); err != nil {
+			return nil, err
+		}
+		return json.Marshal(index)
+	})
+	s.serveBody(w, r, body, err, "application/json")
+}
+
+// serveArchive serves the sources of a version of a package. Published
+// archives are served as is.
+func (s *registryServer) serveArchive(w http.ResponseWriter, r *http.Request,
+	key, dir string) {
+
+	archive := filepath.Join(dir, registryArchive)
+	if _, err := os.Stat(archive); err == nil {
+		w.Header().Set("Content-Type", "application/gzip")
+		http.ServeFile(w, r, archive)
+		return
+	}
+
+	fingerprint, err := treeFingerprint(dir)
+	if err != nil {
+		s.serveBody(w, r, nil, err, "")
+		return
+	}
+
+	key += "/" + registryArchive
+	body, err := s.cached(key, fingerprint, func() ([]byte, error) {
+		var buf bytes.Buffer
+		err := writeTarGz(dir, nil, &buf)
+		return buf.Bytes(), err
+	})
+	s.serveBody(w, r, body, err, "application/gzip")
+}
+
+// servePublish adds the uploaded archive of a version to the repository.
+func (s *registryServer) servePublish(w http.ResponseWriter, r *http.Request,
+	name string, v *pack.Version) {
+
+	archive, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPublishSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(archive) > maxPublishSize {
+		http.Error(w, "Archive is too large",
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = s.repo().Publish(name, v, archive)
+	_, invalid := err.(packfileMismatchError)
+	if _, ok := err.(publishedError); ok {
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else if invalid || err == errNoArchivePackfile ||
+		err == gzip.ErrHeader {
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// serveBody writes a generated response, or the error that prevented it.
+func (s *registryServer) serveBody(w http.ResponseWriter, r *http.Request,
+	body []byte, err error, contentType string) {
+
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
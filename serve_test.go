@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+func TestServe(t *T) {
+	root := mkTree(t, testRepository)
+	defer os.RemoveAll(root)
+
+	reg := newRegistryServer(root, false)
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	r := newRegistryClient(srv.URL)
+	name := "example.com/apple"
+
+	vs := r.GetVersions(name)
+	if len(vs) != 2 || vs[0].String() != "1.1.0" || vs[1].String() != "1.0.0" {
+		t.Error("Expected versions 1.1.0 and 1.0.0, got:", vs)
+	}
+	if p := r.GetPack(name, vs[1]); p.License != "MIT" {
+		t.Error("Expected the MIT license, got:", p.License)
+	}
+	if err := r.Err(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	dest := filepath.Join(root, "dest")
+	if err := r.Fetch(name, vs[0], dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dest, "apple.go")); string(b) !=
+		"package apple // 1.1.0" {
+
+		t.Error("Wrong contents fetched:", string(b))
+	}
+
+	listing := name + "/" + registryVersions
+	if _, ok := reg.cache[listing]; !ok {
+		t.Error("Expected the version listing to be cached")
+	}
+	reg.cache[listing] = cachedResource{reg.cache[listing].fingerprint,
+		[]byte(`{"versions": ["1.1.0"]}`)}
+	if vs = newRegistryClient(srv.URL).GetVersions(name); len(vs) != 1 {
+		t.Error("Expected the cached version listing, got:", vs)
+	}
+
+	os.MkdirAll(filepath.Join(root, "example.com", "apple", "2.0.0"), 0775)
+	if vs = newRegistryClient(srv.URL).GetVersions(name); len(vs) != 3 {
+		t.Error("Expected the version cache to be refreshed, got:", vs)
+	}
+
+	for _, path := range []string{
+		"/example.com/apple/../banana/versions",
+		"/example.com/apple/9.9.9/archive.tar.gz",
+		"/example.com/apple/1.0.0/apple.go",
+		"/versions",
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected %s to be not found, got: %s", path, resp.Status)
+		}
+	}
+}
+
+func TestServe_Cache(t *T) {
+	root := mkTree(t, testRepository)
+	defer os.RemoveAll(root)
+
+	srv := newRegistryServer(root, false)
+	vdir := filepath.Join(root, "example.com", "apple", "1.0.0")
+	generated := 0
+	cached := func(key string) error {
+		fingerprint, err := treeFingerprint(vdir)
+		if err == nil {
+			_, err = srv.cached(key, fingerprint, func() ([]byte, error) {
+				generated++
+				return []byte("archive"), nil
+			})
+		}
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := cached("apple"); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+	if generated != 1 {
+		t.Error("Expected the archive to be generated once, got:", generated)
+	}
+
+	// Rewrite a file in place without changing the directory's mtime.
+	file := filepath.Join(vdir, "apple.go")
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	dirInfo, err := os.Stat(vdir)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = ioutil.WriteFile(file, []byte("package apple // new"),
+		0664); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	os.Chtimes(file, info.ModTime(), info.ModTime())
+	os.Chtimes(vdir, dirInfo.ModTime(), dirInfo.ModTime())
+
+	if err = cached("apple"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if generated != 2 {
+		t.Error("Expected the rewritten file to invalidate the cache")
+	}
+
+	for i := 0; i < maxCachedResources+5; i++ {
+		cached(fmt.Sprint("key", i))
+	}
+	if len(srv.cache) != maxCachedResources ||
+		len(srv.cachedKeys) != maxCachedResources {
+
+		t.Error("Expected the cache to be bounded, got:", len(srv.cache))
+	}
+	if _, ok := srv.cache["apple"]; ok {
+		t.Error("Expected the oldest resource to be dropped")
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aarondl/pack"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	registrySource   = "registry"
+	repositorySource = "repository"
+	gitSource        = "git"
+)
+
+var (
+	errSourceName = errors.New("Every source must have a name.")
+)
+
+// source is a configured source along with the provider that reads it.
+type source struct {
+	*Source
+	vp versionProvider
+}
+
+// matches checks if a source may be consulted for a package.
+func (s *source) matches(name string) bool {
+	if len(s.Prefixes) == 0 || s.claims(name) {
+		return true
+	}
+	for _, prefix := range s.Prefixes {
+		if prefix == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// claims checks if one of a source's prefixes, other than *, matches a
+// package.
+func (s *source) claims(name string) bool {
+	for _, prefix := range s.Prefixes {
+		switch {
+		case prefix == "*":
+		case strings.HasSuffix(prefix, "/*"):
+			if strings.HasPrefix(name, strings.TrimSuffix(prefix, "*")) {
+				return true
+			}
+		case name == prefix || strings.HasPrefix(name, prefix+"/"):
+			return true
+		}
+	}
+	return false
+}
+
+// byPriority sorts sources from highest to lowest priority.
+type byPriority []*Source
+
+func (b byPriority) Len() int           { return len(b) }
+func (b byPriority) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byPriority) Less(i, j int) bool { return b[i].Priority > b[j].Priority }
+
+// configSources gets the configured sources in the order they're consulted.
+// Registry and Repository follow the explicit sources, and when no source
+// covers every package the packages' git repositories are used: either for
+// just the packages with Remotes, or for all packages if nothing else is
+// configured.
+func configSources() []*Source {
+	sources := make([]*Source, len(config.Sources))
+	copy(sources, config.Sources)
+	sort.Stable(byPriority(sources))
+
+	if len(config.Registry) > 0 {
+		sources = append(sources, &Source{
+			Name: registrySource, Registry: config.Registry,
+		})
+	}
+	if len(config.Repository) > 0 {
+		sources = append(sources, &Source{
+			Name: repositorySource, Repository: config.Repository,
+		})
+	}
+
+	if len(sources) == 0 {
+		return []*Source{{Name: gitSource, Git: true}}
+	}
+	if len(config.Remotes) > 0 {
+		remotes := &Source{Name: gitSource, Git: true}
+		for name := range config.Remotes {
+			remotes.Prefixes = append(remotes.Prefixes, name)
+		}
+		sort.Strings(remotes.Prefixes)
+		sources = append(sources, remotes)
+	}
+	return sources
+}
+
+// newSourceProvider creates the provider that reads a source, authenticating
+// with the credentials of its host and retrying fetches by a retry policy.
+func newSourceProvider(s *Source, creds *credentialStore,
+	retry *retryPolicy) (versionProvider, error) {
+
+	kinds := 0
+	var vp versionProvider
+	if len(s.Registry) > 0 {
+		kinds++
+		r := newRegistryClient(s.Registry)
+		r.creds = creds
+		r.retry = retry
+		r.client = retry.httpClient()
+		vp = r
+	}
+	if len(s.Repository) > 0 {
+		kinds++
+		vp = newLocalRepository(s.Repository)
+	}
+	if s.Git {
+		kinds++
+		g := newGitProvider(filepath.Join(PATHS.GopackPath, gitCacheDir))
+		g.creds = creds
+		g.retry = retry
+		vp = g
+	}
+
+	if kinds != 1 {
+		return nil, fmt.Errorf(
+			"Source %q must set exactly one of registry, repository or git.",
+			s.Name)
+	}
+	return vp, nil
+}
+
+// compositeProvider is a versionProvider that consults several sources in
+// order and merges the versions they have. A version found in more than one
+// source comes from the first one. It remembers where every version came from
+// so graphs, packfiles and sources are read from the same place.
+type compositeProvider struct {
+	sources []*source
+	// origins maps package names to the source of each of their versions.
+	origins  map[string]map[string]*source
+	versions map[string][]*pack.Version
+	mu       sync.Mutex
+}
+
+// newCompositeProvider creates a provider for a list of sources.
+func newCompositeProvider(sources []*Source, creds *credentialStore,
+	retry *retryPolicy) (*compositeProvider, error) {
+
+	c := &compositeProvider{
+		origins:  make(map[string]map[string]*source),
+		versions: make(map[string][]*pack.Version),
+	}
+
+	names := make(map[string]bool)
+	for _, s := range sources {
+		if len(s.Name) == 0 {
+			return nil, errSourceName
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("Source %q is configured twice.", s.Name)
+		}
+		names[s.Name] = true
+
+		vp, err := newSourceProvider(s, creds, retry)
+		if err != nil {
+			return nil, err
+		}
+		c.sources = append(c.sources, &source{s, vp})
+	}
+	return c, nil
+}
+
+// loggingProvider is implemented by the providers that log which package each
+// of their errors was for.
+type loggingProvider interface {
+	failures() *failureLog
+}
+
+// Err returns the first error the sources encountered. A source failing to
+// list a package is only an error when no other source had it.
+func (c *compositeProvider) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.sources {
+		lp, ok := s.vp.(loggingProvider)
+		if !ok {
+			continue
+		}
+		log := lp.failures()
+		for _, name := range log.failed {
+			if !c.servedElsewhere(name, s) {
+				return fmt.Errorf("%s: %v", s.Name, log.errs[name])
+			}
+		}
+	}
+	return nil
+}
+
+// servedElsewhere checks if the versions of a package all come from sources
+// other than s. The lock must be held.
+func (c *compositeProvider) servedElsewhere(name string, s *source) bool {
+	origins := c.origins[name]
+	for _, origin := range origins {
+		if origin == s {
+			return false
+		}
+	}
+	return len(origins) > 0
+}
+
+// GetVersions gets the versions every matching source has, highest first.
+func (c *compositeProvider) GetVersions(name string) []*pack.Version {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.getVersions(name)
+}
+
+// getVersions is GetVersions for callers holding the lock.
+func (c *compositeProvider) getVersions(name string) []*pack.Version {
+	if vs, ok := c.versions[name]; ok {
+		return vs
+	}
+
+	origins := c.origins[name]
+	if origins == nil {
+		origins = make(map[string]*source)
+		c.origins[name] = origins
+	}
+
+	var vs []*pack.Version
+	for _, s := range c.consulted(name) {
+		for _, v := range s.vp.GetVersions(name) {
+			if _, ok := origins[v.String()]; !ok {
+				origins[v.String()] = s
+				vs = append(vs, v)
+			}
+		}
+	}
+
+	sort.Sort(byVersion(vs))
+	c.versions[name] = vs
+	return vs
+}
+
+// consulted gets the sources consulted for a package, in order. The sources
+// claiming a package are consulted exclusively, so that a private package
+// can't be replaced by publishing one with the same name to another source.
+func (c *compositeProvider) consulted(name string) []*source {
+	var claimed, matched []*source
+	for _, s := range c.sources {
+		if s.claims(name) {
+			claimed = append(claimed, s)
+		}
+		if s.matches(name) {
+			matched = append(matched, s)
+		}
+	}
+	if len(claimed) > 0 {
+		return claimed
+	}
+	return matched
+}
+
+// origin gets the source a version of a package comes from, returns nil if no
+// source has it.
+func (c *compositeProvider) origin(name string, v *pack.Version) *source {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.origins[name][v.String()]; ok {
+		return s
+	}
+	c.getVersions(name)
+	return c.origins[name][v.String()]
+}
+
+// GetGraph gets the dependency graph of a version from its source.
+func (c *compositeProvider) GetGraph(name string, v *pack.Version) *depgraph {
+	if s := c.origin(name, v); s != nil {
+		return s.vp.GetGraph(name, v)
+	}
+	return &depgraph{head: &depnode{d: &pack.Dependency{Name: name}, v: v}}
+}
+
+// GetPack gets the packfile of a version from its source, returns nil if the
+// source can't supply packfiles.
+func (c *compositeProvider) GetPack(name string, v *pack.Version) *pack.Pack {
+	if pp, ok := c.originProvider(name, v).(packProvider); ok {
+		return pp.GetPack(name, v)
+	}
+	return nil
+}
+
+// Fetch fetches a version of a package from its source.
+func (c *compositeProvider) Fetch(name string, v *pack.Version,
+	dest string) error {
+
+	s := c.origin(name, v)
+	if s == nil {
+		return fmt.Errorf("No source has %s %s.", name, v)
+	}
+	f, ok := s.vp.(fetcher)
+	if !ok {
+		return fmt.Errorf("Source %q can't fetch packages.", s.Name)
+	}
+	return f.Fetch(name, v, dest)
+}
+
+// originProvider gets the provider of a version's source, or nil.
+func (c *compositeProvider) originProvider(name string,
+	v *pack.Version) versionProvider {
+
+	if s := c.origin(name, v); s != nil {
+		return s.vp
+	}
+	return nil
+}
+
+// sourceOf gets the name of the source a version of a package comes from.
+func (c *compositeProvider) sourceOf(name string, v *pack.Version) string {
+	if s := c.origin(name, v); s != nil {
+		return s.Name
+	}
+	return ""
+}
+
+// pin makes the versions in a lockfile come from the sources recorded for
+// them.
+func (c *compositeProvider) pin(l *lockfile) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range l.Packages {
+		if len(e.Source) == 0 {
+			continue
+		}
+		var found *source
+		for _, s := range c.sources {
+			if s.Name == e.Source {
+				found = s
+				break
+			}
+		}
+		if found == nil {
+			return fmt.Errorf("%s %s was locked from unknown source %q.",
+				e.Name, e.Version, e.Source)
+		}
+
+		if c.origins[e.Name] == nil {
+			c.origins[e.Name] = make(map[string]*source)
+		}
+		c.origins[e.Name][e.Version] = found
+	}
+	return nil
+}
+
+// lockSources records in a lockfile which source every package came from.
+func lockSources(l *lockfile, vp versionProvider) error {
+	c, ok := vp.(*compositeProvider)
+	if !ok {
+		return nil
+	}
+	for _, e := range l.Packages {
+		v, err := e.version()
+		if err != nil {
+			return err
+		}
+		e.Source = c.sourceOf(e.Name, v)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+)
+
+func TestSources_Matches(t *T) {
+	s := &source{Source: &Source{Prefixes: []string{
+		"corp.example.com/*", "example.com/apple",
+	}}}
+	tests := []struct {
+		name   string
+		expect bool
+	}{
+		{"corp.example.com/lib", true},
+		{"corp.example.com/lib/sub", true},
+		{"corp.example.com", false},
+		{"example.com/apple", true},
+		{"example.com/apple/sub", true},
+		{"example.com/applesauce", false},
+		{"other.org/x", false},
+	}
+
+	for _, test := range tests {
+		if got := s.matches(test.name); got != test.expect {
+			t.Errorf("%s: Expected %v, got %v", test.name, test.expect, got)
+		}
+	}
+
+	if all := (&source{Source: &Source{}}); !all.matches("other.org/x") {
+		t.Error("Expected a source without prefixes to match everything")
+	}
+	s.Prefixes = append(s.Prefixes, "*")
+	if !s.matches("other.org/x") || s.claims("other.org/x") {
+		t.Error("Expected * to match other.org/x without claiming it")
+	}
+	if !s.claims("example.com/apple") {
+		t.Error("Expected example.com/apple to be claimed")
+	}
+}
+
+func TestSources_ConfigSources(t *T) {
+	defer func() { config = Configuration{} }()
+
+	config = Configuration{}
+	sources := configSources()
+	if len(sources) != 1 || !sources[0].Git || len(sources[0].Prefixes) != 0 {
+		t.Error("Expected git to be the only source, got:", sources)
+	}
+
+	config = Configuration{
+		Sources: []*Source{
+			{Name: "mirror", Registry: "http://mirror"},
+			{Name: "corp", Registry: "http://corp", Priority: 10},
+		},
+		Repository: "/repo",
+		Remotes:    map[string]string{"example.com/x": "git@example.com:x"},
+	}
+	var names []string
+	for _, s := range configSources() {
+		names = append(names, s.Name)
+	}
+	expect := "corp mirror repository git"
+	if got := strings.Join(names, " "); got != expect {
+		t.Errorf("Expected sources %q, got %q", expect, got)
+	}
+
+	bad := &Source{Name: "bad", Registry: "http://bad", Repository: "/bad"}
+	if _, err := newCompositeProvider([]*Source{bad}, nil, nil); err == nil {
+		t.Error("Expected an error for a source of two kinds")
+	}
+	dup := []*Source{
+		{Name: "a", Repository: "/a"}, {Name: "a", Repository: "/b"},
+	}
+	if _, err := newCompositeProvider(dup, nil, nil); err == nil {
+		t.Error("Expected an error for duplicate source names")
+	}
+}
+
+func TestSources_Composite(t *T) {
+	corp := mkTree(t, map[string]string{
+		"corp.example.com/lib/1.0.0/lib.go":  "package lib",
+		"example.com/banana/1.0.0/banana.go": "package banana // corp",
+		"example.com/banana/3.0.0/banana.go": "package banana // 3.0.0",
+	})
+	defer os.RemoveAll(corp)
+	mirror := mkTree(t, testRepository)
+	defer os.RemoveAll(mirror)
+
+	c, err := newCompositeProvider([]*Source{
+		{Name: "corp", Repository: corp, Prefixes: []string{
+			"corp.example.com/*", "example.com/banana",
+		}},
+		{Name: "mirror", Repository: mirror},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	// The mirror's banana 1.2.0 is ignored since corp claims banana.
+	vs := c.GetVersions("example.com/banana")
+	if len(vs) != 2 || vs[0].String() != "3.0.0" || vs[1].String() != "1.0.0" {
+		t.Error("Expected only corp's versions of banana, got:", vs)
+	}
+	if got := c.sourceOf("example.com/banana", vs[1]); got != "corp" {
+		t.Error("Expected banana 1.0.0 to come from corp, got:", got)
+	}
+	if vs = c.GetVersions("example.com/apple"); len(vs) != 2 {
+		t.Error("Expected apple to come from the mirror, got:", vs)
+	}
+
+	dir := mkTree(t, nil)
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "banana")
+	err = c.Fetch("example.com/banana", mkVers("1.0.0")[0], dest)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dest, "banana.go"))
+	if err != nil || string(b) != "package banana // corp" {
+		t.Error("Expected banana to be fetched from corp, got:", string(b))
+	}
+
+	lock := &lockfile{Packages: []*lockentry{
+		{Name: "example.com/banana", Version: "1.0.0"},
+		{Name: "example.com/apple", Version: "1.1.0"},
+	}}
+	if err = lockSources(lock, c); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	banana, apple := lock.Packages[0], lock.Packages[1]
+	if banana.Source != "corp" || apple.Source != "mirror" {
+		t.Error("Expected sources to be recorded, got:", banana, apple)
+	}
+
+	lock.Packages[0].Source = "elsewhere"
+	if err = c.pin(lock); err == nil {
+		t.Error("Expected an error for an unknown source")
+	}
+}
+
+func TestSources_CompositeErr(t *T) {
+	mirror := mkTree(t, testRepository)
+	defer os.RemoveAll(mirror)
+	// A repository rooted at a file fails to list every package.
+	broken := filepath.Join(mirror, "example.com", "apple", "1.0.0", "apple.go")
+
+	c, err := newCompositeProvider([]*Source{
+		{Name: "broken", Repository: broken},
+		{Name: "mirror", Repository: mirror},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if vs := c.GetVersions("example.com/apple"); len(vs) != 2 {
+		t.Error("Expected apple to come from the mirror, got:", vs)
+	}
+	if err = c.Err(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	c.GetVersions("example.com/nope")
+	if err = c.Err(); err == nil || !strings.HasPrefix(err.Error(), "broken") {
+		t.Error("Expected an error from the broken source, got:", err)
+	}
+}
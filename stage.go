@@ -0,0 +1,435 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	stagePrefix = ".stage"
+)
+
+var (
+	errInterrupted = errors.New("Interrupted, the packset was not changed.")
+)
+
+// staging holds fetched packages in a temporary directory until they're
+// swapped into place. The packages they replace are kept so the swap can be
+// rolled back until it's committed. Interrupts are caught while staging so
+// that they roll back instead of killing the process halfway.
+type staging struct {
+	in   *installer
+	root string
+	// fetchRoot is where packages are fetched before they're moved into
+	// the store, it's next to the store so the move doesn't cross devices.
+	fetchRoot string
+	// staged maps package names to the directory they were fetched into.
+	staged  map[string]string
+	swapped []string
+	// replaced maps swapped package names to where the package they
+	// replaced was moved.
+	replaced map[string]string
+	// locked holds the names of the activated packages.
+	locked []string
+	// installed holds the names of every package that's installed or being
+	// installed, so packages nested in a replaced package can be kept.
+	installed []string
+	// carried maps swapped package names to the packages nested in them that
+	// were moved from the package they replaced.
+	carried   map[string][]string
+	signals   chan os.Signal
+	stopped   bool
+	committed bool
+}
+
+// stage fetches every activated package into a staging directory. A package
+// is skipped if it is already installed at the version recorded for it in the
+// previous lockfile. Packages are fetched concurrently, once a fetch fails or
+// the process is interrupted no new fetches are started and the staging
+// directory is removed.
+func (in *installer) stage(acts map[string]*activation,
+	previous *lockfile) (*staging, error) {
+
+	var todo []*activation
+	installed := activationNames(acts)
+	for _, e := range previous.Packages {
+		if _, ok := acts[e.Name]; !ok && checkPackageName(e.Name) == nil {
+			installed = append(installed, e.Name)
+		}
+	}
+	for _, name := range activationNames(acts) {
+		if err := checkPackageName(name); err != nil {
+			return nil, err
+		}
+		act := acts[name]
+
+		if prev := previous.find(name); prev != nil &&
+			prev.Version == act.version.String() {
+
+			if _, err := os.Stat(in.dir(name)); err == nil {
+				continue
+			}
+		}
+		todo = append(todo, act)
+	}
+
+	if err := os.MkdirAll(in.tmp, 0775); err != nil {
+		return nil, err
+	}
+	root, err := ioutil.TempDir(in.tmp, stagePrefix)
+	if err != nil {
+		return nil, err
+	}
+	fetchRoot := root
+	if parent := filepath.Dir(in.store); parent != filepath.Clean(in.tmp) {
+		err = os.MkdirAll(parent, 0775)
+		if err == nil {
+			fetchRoot, err = ioutil.TempDir(parent, stagePrefix)
+		}
+		if err != nil {
+			os.RemoveAll(root)
+			return nil, err
+		}
+	}
+
+	s := &staging{
+		in:        in,
+		root:      root,
+		fetchRoot: fetchRoot,
+		locked:    activationNames(acts),
+		staged:    make(map[string]string),
+		replaced:  make(map[string]string),
+		installed: installed,
+		carried:   make(map[string][]string),
+		signals:   make(chan os.Signal, 1),
+	}
+	signal.Notify(s.signals, os.Interrupt)
+
+	if err = s.fetch(todo, previous); err != nil {
+		s.discard()
+		return nil, err
+	}
+	return s, nil
+}
+
+// fetch fetches packages into the staging directory with the installer's
+// workers.
+func (s *staging) fetch(todo []*activation, previous *lockfile) error {
+	if len(todo) == 0 {
+		return nil
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	jobs := make(chan *activation)
+	prog := newProgress(s.in.out, len(todo))
+
+	for i := 0; i < s.in.workers && i < len(todo); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for act := range jobs {
+				prog.start(act)
+				mu.Lock()
+				n := strconv.Itoa(len(s.staged))
+				dest := filepath.Join(s.root, "new", n)
+				s.staged[act.Name] = dest
+				mu.Unlock()
+
+				var hash string
+				if prev := previous.find(act.Name); prev != nil &&
+					prev.Version == act.version.String() {
+
+					hash = prev.Hash
+				}
+				tmp := filepath.Join(s.fetchRoot, "fetch", n)
+				size, err := s.fetchPackage(act, dest, tmp, hash)
+				prog.done(act, size, err)
+
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, act := range todo {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+
+		select {
+		case jobs <- act:
+		case <-s.signals:
+			s.stopped = true
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	prog.finish()
+
+	if firstErr == nil && s.interrupted() {
+		return errInterrupted
+	}
+	return firstErr
+}
+
+// fetchPackage stages a package in dest by linking or copying it from the
+// store. Unless the store already holds an intact tree with the hash the
+// package is expected to have, it's fetched into tmp and moved into the store
+// first, without the activated packages nested in it since they're installed
+// on their own. It returns the size of the package.
+func (s *staging) fetchPackage(act *activation, dest, tmp, hash string) (int64,
+	error) {
+
+	ok, err := storedTree(s.in.store, hash)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		if err = s.in.f.Fetch(act.Name, act.version, tmp); err != nil {
+			return 0, err
+		}
+		for _, n := range nestedPackages(act.Name, s.locked) {
+			err = os.RemoveAll(filepath.Join(tmp, filepath.FromSlash(n)))
+			if err != nil {
+				return 0, err
+			}
+		}
+		if hash, err = storeTree(s.in.store, tmp); err != nil {
+			return 0, err
+		}
+	}
+	stored := storePath(s.in.store, hash)
+
+	if s.in.copy {
+		err = copyTree(stored, dest)
+	} else {
+		err = linkTree(stored, dest)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return treeSize(stored)
+}
+
+// interrupted checks if the process has been interrupted since staging began.
+func (s *staging) interrupted() bool {
+	if !s.stopped {
+		select {
+		case <-s.signals:
+			s.stopped = true
+		default:
+		}
+	}
+	return s.stopped
+}
+
+// dir gets the directory a package is in, its staged directory if it was
+// fetched and its installed directory otherwise.
+func (s *staging) dir(name string) string {
+	if dir, ok := s.staged[name]; ok {
+		return dir
+	}
+	return s.in.dir(name)
+}
+
+// swap moves the staged packages into place, moving the packages they
+// replace into the staging directory. Everything is moved back if a move fails
+// or the process is interrupted.
+func (s *staging) swap() error {
+	for _, name := range s.stagedNames() {
+		if s.interrupted() {
+			s.rollback()
+			return errInterrupted
+		}
+		if err := s.swapPackage(name); err != nil {
+			s.rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// stagedNames returns the names of the staged packages in order, so parents
+// are swapped before the packages nested in them.
+func (s *staging) stagedNames() []string {
+	names := make([]string, 0, len(s.staged))
+	for name := range s.staged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// swapPackage moves a single staged package into place. Packages nested in
+// the package it replaces that aren't staged themselves are moved into it.
+func (s *staging) swapPackage(name string) error {
+	dest := s.in.dir(name)
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return err
+	}
+
+	old := filepath.Join(s.root, "old", strconv.Itoa(len(s.replaced)))
+	if _, err := os.Lstat(dest); err == nil {
+		if err = os.MkdirAll(filepath.Dir(old), 0775); err != nil {
+			return err
+		}
+		if err = os.Rename(dest, old); err != nil {
+			return err
+		}
+		s.replaced[name] = old
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	s.swapped = append(s.swapped, name)
+
+	if err := os.Rename(s.staged[name], dest); err != nil {
+		return err
+	}
+	if old, ok := s.replaced[name]; ok {
+		return s.carry(name, old)
+	}
+	return nil
+}
+
+// nested gets the packages nested in a package that aren't staged, leaving
+// out those nested in one of the others since they're moved along with it.
+func (s *staging) nested(name string) []string {
+	var nested []string
+	for _, n := range s.installed {
+		if _, ok := s.staged[n]; ok || !strings.HasPrefix(n, name+"/") {
+			continue
+		}
+		outer := true
+		for _, other := range s.installed {
+			_, staged := s.staged[other]
+			if !staged && other != n && strings.HasPrefix(other, name+"/") &&
+				strings.HasPrefix(n, other+"/") {
+
+				outer = false
+				break
+			}
+		}
+		if outer {
+			nested = append(nested, n)
+		}
+	}
+	sort.Strings(nested)
+	return nested
+}
+
+// carry moves the nested packages of a replaced package from where it was
+// moved to into the package that replaced it.
+func (s *staging) carry(name, old string) error {
+	for _, n := range s.nested(name) {
+		rel, err := filepath.Rel(s.in.dir(name), s.in.dir(n))
+		if err != nil {
+			return err
+		}
+		src := filepath.Join(old, rel)
+		if _, err = os.Lstat(src); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		dest := s.in.dir(n)
+		if err = os.RemoveAll(dest); err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+			return err
+		}
+		if err = os.Rename(src, dest); err != nil {
+			return err
+		}
+		s.carried[name] = append(s.carried[name], n)
+	}
+	return nil
+}
+
+// rollback undoes the swap in reverse order, restoring replaced packages
+// along with the packages that were carried out of them.
+func (s *staging) rollback() error {
+	var firstErr error
+	for i := len(s.swapped) - 1; i >= 0; i-- {
+		name := s.swapped[i]
+		dest := s.in.dir(name)
+
+		err := s.uncarry(name)
+		if err == nil {
+			err = os.RemoveAll(dest)
+		}
+		if old, ok := s.replaced[name]; ok && err == nil {
+			err = os.Rename(old, dest)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.swapped = nil
+	s.replaced = make(map[string]string)
+	s.carried = make(map[string][]string)
+	return firstErr
+}
+
+// uncarry moves the nested packages carried into a swapped package back into
+// the package it replaced.
+func (s *staging) uncarry(name string) error {
+	carried := s.carried[name]
+	for i := len(carried) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(s.in.dir(name), s.in.dir(carried[i]))
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(s.replaced[name], rel)
+		if err = os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+			return err
+		}
+		if err = os.Rename(s.in.dir(carried[i]), dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit keeps the swapped packages, after which discard no longer rolls
+// them back.
+func (s *staging) commit() {
+	s.committed = true
+}
+
+// discard rolls back an uncommitted swap and removes the staging directory.
+func (s *staging) discard() error {
+	signal.Stop(s.signals)
+
+	var err error
+	if !s.committed {
+		err = s.rollback()
+	}
+	if rerr := os.RemoveAll(s.root); err == nil {
+		err = rerr
+	}
+	if rerr := os.RemoveAll(s.fetchRoot); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+// oldApple is the file only the installed version of apple has.
+func oldApple(dir string) string {
+	return filepath.Join(dir, "set", "apple", "old.go")
+}
+
+// mkStaging stages apple 2.0.0 and banana 1.0.0 over an installed apple
+// 1.0.0.
+func mkStaging(t *T, tf *testFetcher) (string, *staging) {
+	dir := mkTree(t, map[string]string{"set/apple/old.go": "package old"})
+	in := &installer{
+		f:       tf,
+		dir:     func(n string) string { return filepath.Join(dir, "set", n) },
+		tmp:     filepath.Join(dir, "tmp"),
+		store:   filepath.Join(dir, "store"),
+		workers: 2,
+		out:     &bytes.Buffer{},
+	}
+
+	acts := map[string]*activation{
+		"apple":  &activation{mkDep("apple"), mkVers("2.0.0")[0], nil},
+		"banana": &activation{mkDep("banana"), mkVers("1.0.0")[0], nil},
+	}
+	s, err := in.stage(acts, new(lockfile))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Unexpected error:", err)
+	}
+	return dir, s
+}
+
+func TestStage_Swap(t *T) {
+	dir, s := mkStaging(t, &testFetcher{})
+	defer os.RemoveAll(dir)
+
+	if s.dir("apple") == filepath.Join(dir, "set", "apple") {
+		t.Error("Expected apple to be staged, got:", s.dir("apple"))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "set", "banana")); err == nil {
+		t.Error("Expected banana not to be installed before swapping")
+	}
+
+	if err := s.swap(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	s.commit()
+	if err := s.discard(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if _, err := os.Stat(oldApple(dir)); err == nil {
+		t.Error("Expected apple to be replaced")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "set", "banana")); err != nil {
+		t.Error("Expected banana to be installed:", err)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Join(dir, "tmp")); len(files) != 0 {
+		t.Error("Expected the staging directory to be removed, got:", files)
+	}
+}
+
+func TestStage_Rollback(t *T) {
+	dir, s := mkStaging(t, &testFetcher{})
+	defer os.RemoveAll(dir)
+
+	if err := s.swap(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := s.discard(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if _, err := os.Stat(oldApple(dir)); err != nil {
+		t.Error("Expected apple to be restored:", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "set", "banana")); err == nil {
+		t.Error("Expected banana to be removed")
+	}
+}
+
+func TestStage_Interrupted(t *T) {
+	dir, s := mkStaging(t, &testFetcher{})
+	defer os.RemoveAll(dir)
+	defer s.discard()
+
+	s.signals <- os.Interrupt
+	if err := s.swap(); err != errInterrupted {
+		t.Error("Expected errInterrupted, got:", err)
+	}
+	if _, err := os.Stat(oldApple(dir)); err != nil {
+		t.Error("Expected apple to be untouched:", err)
+	}
+}
+
+func TestStage_FetchFailed(t *T) {
+	dir := mkTree(t, map[string]string{"set/apple/old.go": "package old"})
+	defer os.RemoveAll(dir)
+	in := &installer{
+		f:       &testFetcher{fail: "banana"},
+		dir:     func(n string) string { return filepath.Join(dir, "set", n) },
+		tmp:     filepath.Join(dir, "tmp"),
+		store:   filepath.Join(dir, "store"),
+		workers: 1,
+		out:     &bytes.Buffer{},
+	}
+
+	acts := map[string]*activation{
+		"apple":  &activation{mkDep("apple"), mkVers("2.0.0")[0], nil},
+		"banana": &activation{mkDep("banana"), mkVers("1.0.0")[0], nil},
+	}
+	if _, err := in.stage(acts, new(lockfile)); err == nil {
+		t.Error("Expected an error")
+	}
+	if _, err := os.Stat(oldApple(dir)); err != nil {
+		t.Error("Expected apple to be untouched:", err)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Join(dir, "tmp")); len(files) != 0 {
+		t.Error("Expected the staging directory to be removed, got:", files)
+	}
+}
+
+func TestStage_FromStore(t *T) {
+	dir, s := mkStaging(t, &testFetcher{})
+	defer os.RemoveAll(dir)
+	hash, err := hashTree(s.dir("banana"), nil)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	s.discard()
+
+	tf := &testFetcher{}
+	s.in.f = tf
+	s.in.dir = func(n string) string { return filepath.Join(dir, "other", n) }
+	acts := map[string]*activation{
+		"banana": &activation{mkDep("banana"), mkVers("1.0.0")[0], nil},
+	}
+	previous := &lockfile{Packages: []*lockentry{
+		{Name: "banana", Version: "1.0.0", Hash: hash},
+	}}
+
+	if s, err = s.in.stage(acts, previous); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer s.discard()
+	if len(tf.fetched) != 0 {
+		t.Error("Expected banana to be linked from the store, got:", tf.fetched)
+	}
+	if got, err := hashTree(s.dir("banana"), nil); err != nil || got != hash {
+		t.Error("Expected the stored tree to be staged, got:", got, err)
+	}
+}
+
+// mkNestedStaging stages apple 2.0.0 over an installed apple 1.0.0 that has
+// apple/sub 1.0.0 nested in it, which is unchanged.
+func mkNestedStaging(t *T) (string, *staging) {
+	dir := mkTree(t, map[string]string{
+		"set/apple/old.go":     "package old",
+		"set/apple/sub/sub.go": "package sub",
+	})
+	in := &installer{
+		f:       &testFetcher{},
+		dir:     func(n string) string { return filepath.Join(dir, "set", n) },
+		tmp:     filepath.Join(dir, "tmp"),
+		store:   filepath.Join(dir, "store"),
+		workers: 2,
+		out:     &bytes.Buffer{},
+	}
+
+	acts := map[string]*activation{
+		"apple":     &activation{mkDep("apple"), mkVers("2.0.0")[0], nil},
+		"apple/sub": &activation{mkDep("apple/sub"), mkVers("1.0.0")[0], nil},
+	}
+	previous := &lockfile{Packages: []*lockentry{
+		{Name: "apple", Version: "1.0.0"},
+		{Name: "apple/sub", Version: "1.0.0"},
+	}}
+	s, err := in.stage(acts, previous)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Unexpected error:", err)
+	}
+	return dir, s
+}
+
+func TestStage_NestedUnchanged(t *T) {
+	dir, s := mkNestedStaging(t)
+	defer os.RemoveAll(dir)
+
+	if names := s.stagedNames(); len(names) != 1 || names[0] != "apple" {
+		t.Fatal("Expected only apple to be staged, got:", names)
+	}
+	if err := s.swap(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	s.commit()
+	if err := s.discard(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if _, err := os.Stat(oldApple(dir)); err == nil {
+		t.Error("Expected apple to be replaced")
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "set", "apple", "VERSION"))
+	if string(b) != "apple 2.0.0" {
+		t.Error("Expected apple 2.0.0 to be installed, got:", string(b))
+	}
+	sub := filepath.Join(dir, "set", "apple", "sub", "sub.go")
+	if _, err := os.Stat(sub); err != nil {
+		t.Error("Expected apple/sub to be kept:", err)
+	}
+}
+
+func TestStage_NestedRollback(t *T) {
+	dir, s := mkNestedStaging(t)
+	defer os.RemoveAll(dir)
+
+	if err := s.swap(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := s.discard(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	if _, err := os.Stat(oldApple(dir)); err != nil {
+		t.Error("Expected apple 1.0.0 to be restored:", err)
+	}
+	sub := filepath.Join(dir, "set", "apple", "sub", "sub.go")
+	if _, err := os.Stat(sub); err != nil {
+		t.Error("Expected apple/sub to be restored:", err)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Join(dir, "tmp")); len(files) != 0 {
+		t.Error("Expected the staging directory to be removed, got:", files)
+	}
+}
+
+func TestStage_Roots(t *T) {
+	dir, s := mkStaging(t, &testFetcher{})
+	defer os.RemoveAll(dir)
+	defer s.discard()
+
+	if !withinDir(filepath.Join(dir, "tmp"), s.root) {
+		t.Error("Expected packages to be staged in tmp, got:", s.root)
+	}
+	if filepath.Dir(s.fetchRoot) != dir {
+		t.Error("Expected packages to be fetched next to the store, got:",
+			s.fetchRoot)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aarondl/pack"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+const (
+	mostConstrainedCount = 5
+)
+
+// pkgstats holds the metrics for a single package in a solved graph.
+type pkgstats struct {
+	name        string
+	version     *pack.Version
+	parents     map[string]bool
+	children    map[string]bool
+	constraints int
+}
+
+// graphstats holds the metrics computed over a solved dependency graph.
+type graphstats struct {
+	total      int
+	maxDepth   int
+	backtracks int
+	packages   map[string]*pkgstats
+}
+
+// byFan sorts package statistics by fan-in, then fan-out, then name.
+type byFan []*pkgstats
+
+func (b byFan) Len() int      { return len(b) }
+func (b byFan) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byFan) Less(i, j int) bool {
+	if len(b[i].parents) != len(b[j].parents) {
+		return len(b[i].parents) > len(b[j].parents)
+	}
+	if len(b[i].children) != len(b[j].children) {
+		return len(b[i].children) > len(b[j].children)
+	}
+	return b[i].name < b[j].name
+}
+
+// byConstraints sorts package statistics by number of constraints, then name.
+type byConstraints []*pkgstats
+
+func (b byConstraints) Len() int      { return len(b) }
+func (b byConstraints) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byConstraints) Less(i, j int) bool {
+	if b[i].constraints != b[j].constraints {
+		return b[i].constraints > b[j].constraints
+	}
+	return b[i].name < b[j].name
+}
+
+// showStats solves the packfile's dependencies and prints metrics about the
+// resulting graph.
+func showStats(file string, args []string, out io.Writer) error {
+	r, err := resolvePackage(file)
+	if err != nil {
+		return err
+	}
+
+	return depgraphStats(r.graph).write(out)
+}
+
+// depgraphStats computes the metrics of a solved dependency graph.
+func depgraphStats(g *depgraph) *graphstats {
+	s := &graphstats{
+		backtracks: g.backtracks,
+		packages:   make(map[string]*pkgstats),
+	}
+	depgraphWalk(g.head, nil, 0, 0, false,
+		func(n, parent *depnode, depth uint, _ uint64, _ bool) {
+			if parent != nil {
+				s.add(n, parent, int(depth))
+			}
+		},
+	)
+	return s
+}
+
+// add records a node reached from parent at the given depth.
+func (s *graphstats) add(n, parent *depnode, depth int) {
+	s.total++
+	if depth > s.maxDepth {
+		s.maxDepth = depth
+	}
+
+	name := n.d.Name
+	ps, ok := s.packages[name]
+	if !ok {
+		ps = &pkgstats{
+			name:     name,
+			parents:  make(map[string]bool),
+			children: make(map[string]bool),
+		}
+		s.packages[name] = ps
+	}
+	if n.v != nil {
+		ps.version = n.v
+	}
+	ps.parents[parent.d.Name] = true
+	ps.constraints += len(n.d.Constraints)
+
+	for _, kid := range n.kids {
+		ps.children[kid.d.Name] = true
+	}
+}
+
+// sorted returns the package statistics in the order given by the sorter.
+func (s *graphstats) sorted(by func([]*pkgstats) sort.Interface) []*pkgstats {
+	list := make([]*pkgstats, 0, len(s.packages))
+	for _, ps := range s.packages {
+		list = append(list, ps)
+	}
+	sort.Sort(by(list))
+	return list
+}
+
+// write prints the statistics report.
+func (s *graphstats) write(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Packages:\t%d\n", s.total)
+	fmt.Fprintf(w, "Unique packages:\t%d\n", len(s.packages))
+	fmt.Fprintf(w, "Maximum depth:\t%d\n", s.maxDepth)
+	fmt.Fprintf(w, "Backtracks:\t%d\n", s.backtracks)
+
+	if len(s.packages) == 0 {
+		return w.Flush()
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Package\tVersion\tFan-in\tFan-out\tConstraints")
+	for _, ps := range s.sorted(func(l []*pkgstats) sort.Interface {
+		return byFan(l)
+	}) {
+		version := "-"
+		if ps.version != nil {
+			version = ps.version.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", ps.name, version,
+			len(ps.parents), len(ps.children), ps.constraints)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Most constrained:")
+	for i, ps := range s.sorted(func(l []*pkgstats) sort.Interface {
+		return byConstraints(l)
+	}) {
+		if i >= mostConstrainedCount || ps.constraints == 0 {
+			break
+		}
+		fmt.Fprintf(w, " %s\t%d\n", ps.name, ps.constraints)
+	}
+
+	return w.Flush()
+}
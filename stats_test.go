@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	. "testing"
+)
+
+func TestStats(t *T) {
+	var g = mkGraph(`
+	root 1.0.0
+	-apple 0.0.1
+	-banana 0.0.1
+	`)
+
+	if _, err := g.solve(&repository); err != nil {
+		t.Fatal("Solution was not found:", err)
+	}
+
+	s := depgraphStats(g)
+	if s.total != 4 {
+		t.Error("Expected 4 packages, got:", s.total)
+	}
+	if len(s.packages) != 3 {
+		t.Error("Expected 3 unique packages, got:", len(s.packages))
+	}
+	if s.maxDepth != 2 {
+		t.Error("Expected a depth of 2, got:", s.maxDepth)
+	}
+	if s.backtracks == 0 {
+		t.Error("Expected the solver to have backtracked.")
+	}
+
+	durian := s.packages["durian"]
+	if durian == nil {
+		t.Fatal("Expected stats for durian.")
+	}
+	if len(durian.parents) != 2 {
+		t.Error("Expected durian to have a fan-in of 2, got:",
+			len(durian.parents))
+	}
+	if durian.constraints != 2 {
+		t.Error("Expected durian to have 2 constraints, got:",
+			durian.constraints)
+	}
+	if apple := s.packages["apple"]; len(apple.children) != 1 {
+		t.Error("Expected apple to have a fan-out of 1, got:",
+			len(apple.children))
+	}
+}
+
+func TestStats_Write(t *T) {
+	var g = mkGraph(`
+	root 1.0.0
+	-apple 1.0.0
+	`)
+	g.head.kids[0].v = g.head.kids[0].d.Constraints[0].Version
+
+	var buf bytes.Buffer
+	if err := depgraphStats(g).write(&buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	str := buf.String()
+	for _, exp := range []string{"Packages:", "Backtracks:", "apple", "1.0.0"} {
+		if !strings.Contains(str, exp) {
+			t.Errorf("Expected output to contain %q, got:\n%s", exp, str)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	storeDir = "store"
+)
+
+// storePath gets the directory in a store that holds the tree with a hash,
+// which must be valid.
+func storePath(store, hash string) string {
+	return filepath.Join(store, strings.Replace(hash, ":", "-", 1))
+}
+
+// storeTree moves a fetched tree into a store under its hash and returns the
+// hash. When the store already holds the tree the fetched copy is removed.
+// Stored files are made read only since every packset linking to them shares
+// them.
+func storeTree(store, dir string) (string, error) {
+	hash, err := hashTree(dir, nil)
+	if err != nil {
+		return "", err
+	}
+	if err = readOnlyTree(dir); err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(store, 0775); err != nil {
+		return "", err
+	}
+
+	path := storePath(store, hash)
+	if ok, err := storedTree(store, hash); err != nil {
+		return "", err
+	} else if ok {
+		return hash, os.RemoveAll(dir)
+	}
+	if err = os.Rename(dir, path); err != nil {
+		// Another fetch may have stored the same tree in the meantime.
+		if _, serr := os.Stat(path); serr != nil {
+			return "", err
+		}
+		return hash, os.RemoveAll(dir)
+	}
+	return hash, nil
+}
+
+// storedTree checks if a store holds an intact tree with a hash. Hashes that
+// aren't valid are never stored, and a tree whose contents no longer match its
+// hash is removed so that it can be stored again.
+func storedTree(store, hash string) (bool, error) {
+	if !validHash.MatchString(hash) {
+		return false, nil
+	}
+	path := storePath(store, hash)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	actual, err := hashTree(path, nil)
+	if err == nil && actual == hash {
+		return true, nil
+	}
+	return false, os.RemoveAll(path)
+}
+
+// readOnlyTree removes the write permissions of the regular files in a
+// directory.
+func readOnlyTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		return os.Chmod(path, info.Mode().Perm()&^0222)
+	})
+}
+
+// linkTree fills dest with hard links to the files in a stored tree so that
+// packsets share the store's disk space. Files that can't be linked, for
+// example because dest is on another device, are copied instead.
+func linkTree(src, dest string) error {
+	return mirrorTree(src, dest, linkFile)
+}
+
+// linkFile hard links a single file, copying it if it can't be linked.
+func linkFile(src, dest string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0775); err != nil {
+		return err
+	}
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+	return copyFile(src, dest, mode)
+}
+
+// mirrorTree recreates a directory's contents in another directory, skipping
+// version control directories. Directories and symlinks are created, regular
+// files are handed to file along with their mode, normalized the same way
+// archives normalize them.
+func mirrorTree(src, dest string,
+	file func(src, dest string, mode os.FileMode) error) error {
+
+	return filepath.Walk(src, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			if path != src && vcsDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0775)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return file(path, target, archiveMode(info.Mode()))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+)
+
+func TestStore_StoreTree(t *T) {
+	files := map[string]string{"a.go": "package a", "sub/b.go": "package b"}
+	dir := mkTree(t, nil)
+	defer os.RemoveAll(dir)
+	store := filepath.Join(dir, "store")
+
+	fetched := mkTree(t, files)
+	defer os.RemoveAll(fetched)
+	expect, err := hashTree(fetched, nil)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	hash, err := storeTree(store, fetched)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if hash != expect {
+		t.Errorf("Expected hash %s, got %s", expect, hash)
+	}
+	if _, err = os.Stat(fetched); !os.IsNotExist(err) {
+		t.Error("Expected the fetched tree to be moved, got:", err)
+	}
+
+	stored := storePath(store, hash)
+	info, err := os.Stat(filepath.Join(stored, "a.go"))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if info.Mode().Perm()&0222 != 0 {
+		t.Error("Expected stored files to be read only, got:", info.Mode())
+	}
+
+	again := mkTree(t, files)
+	defer os.RemoveAll(again)
+	if hash, err = storeTree(store, again); err != nil || hash != expect {
+		t.Error("Expected the same hash, got:", hash, err)
+	}
+	if _, err = os.Stat(again); !os.IsNotExist(err) {
+		t.Error("Expected the duplicate tree to be removed, got:", err)
+	}
+}
+
+func TestStore_LinkTree(t *T) {
+	src := mkTree(t, map[string]string{
+		"a.go":      "package a",
+		"sub/b.go":  "package b",
+		".git/HEAD": "ref: refs/heads/master",
+	})
+	defer os.RemoveAll(src)
+	dest := filepath.Join(mkTree(t, nil), "pkg")
+	defer os.RemoveAll(filepath.Dir(dest))
+
+	if err := linkTree(src, dest); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dest, "sub", "b.go"))
+	if err != nil || string(b) != "package b" {
+		t.Error("Expected sub/b.go to be linked, got:", string(b), err)
+	}
+	srcInfo, _ := os.Stat(filepath.Join(src, "a.go"))
+	destInfo, err := os.Stat(filepath.Join(dest, "a.go"))
+	if err != nil || !os.SameFile(srcInfo, destInfo) {
+		t.Error("Expected a.go to be a hard link:", err)
+	}
+	if _, err = os.Stat(filepath.Join(dest, ".git")); err == nil {
+		t.Error("Expected .git to be skipped")
+	}
+}
+
+func TestStore_StoredTree(t *T) {
+	dir := mkTree(t, nil)
+	defer os.RemoveAll(dir)
+	store := filepath.Join(dir, "store")
+
+	fetched := mkTree(t, map[string]string{"a.go": "package a"})
+	defer os.RemoveAll(fetched)
+	hash, err := storeTree(store, fetched)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	for _, bad := range []string{"", "sha256:../../x", "md5:abc",
+		"sha256:" + strings.Repeat("A", 64)} {
+
+		if ok, err := storedTree(store, bad); ok || err != nil {
+			t.Errorf("Expected %q not to be stored, got: %v %v", bad, ok, err)
+		}
+	}
+	if ok, err := storedTree(store, hash); !ok || err != nil {
+		t.Error("Expected the tree to be stored, got:", ok, err)
+	}
+
+	file := filepath.Join(storePath(store, hash), "a.go")
+	os.Chmod(file, 0664)
+	if err = ioutil.WriteFile(file, []byte("package evil"), 0664); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if ok, err := storedTree(store, hash); ok || err != nil {
+		t.Error("Expected a modified tree not to be reused, got:", ok, err)
+	}
+	if _, err = os.Stat(storePath(store, hash)); !os.IsNotExist(err) {
+		t.Error("Expected the modified tree to be removed, got:", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"github.com/aarondl/pack"
+	"launchpad.net/goyaml"
+	"sort"
+	"strings"
+)
+
+// failingProvider is optionally implemented by a versionProvider that can fail
+// to look up versions or graphs. Err returns the first failure.
+type failingProvider interface {
+	Err() error
+}
+
+// failureLog records the errors a provider encountered, along with the package
+// each was for, so that providers combining several sources can tell which
+// packages couldn't be looked up.
+type failureLog struct {
+	failed []string
+	errs   map[string]error
+}
+
+// Err returns the first error encountered while looking up packages.
+func (f *failureLog) Err() error {
+	if len(f.failed) == 0 {
+		return nil
+	}
+	return f.errs[f.failed[0]]
+}
+
+// fail records an error for a package if none has been recorded for it yet.
+func (f *failureLog) fail(name string, err error) {
+	if _, ok := f.errs[name]; ok {
+		return
+	}
+	if f.errs == nil {
+		f.errs = make(map[string]error)
+	}
+	f.failed = append(f.failed, name)
+	f.errs[name] = err
+}
+
+// failures gets the log of a provider's errors.
+func (f *failureLog) failures() *failureLog {
+	return f
+}
+
+// gitProvider is a versionProvider that discovers versions from the semver
+// tags of a package's git repository, and reads dependencies from the
+// packfile at each tag.
+type gitProvider struct {
+	*gitFetcher
+	failureLog
+	versions map[string][]*pack.Version
+	packs    map[string]*pack.Pack
+}
+
+// newGitProvider creates a git provider that mirrors repositories into cache.
+func newGitProvider(cache string) *gitProvider {
+	return &gitProvider{
+		gitFetcher: newGitFetcher(cache),
+		versions:   make(map[string][]*pack.Version),
+		packs:      make(map[string]*pack.Pack),
+	}
+}
+
+// parseTagVersion parses a tag as a version, tags may be prefixed with a v.
+func parseTagVersion(tag string) (*pack.Version, error) {
+	return pack.ParseVersion(strings.TrimPrefix(tag, "v"))
+}
+
+// GetVersions gets the versions of a package from its tags, highest first.
+// Tags that aren't versions are ignored.
+func (g *gitProvider) GetVersions(name string) []*pack.Version {
+	if vs, ok := g.versions[name]; ok {
+		return vs
+	}
+
+	dir, err := g.mirror(name)
+	if err != nil {
+		g.fail(name, err)
+		return nil
+	}
+	tags, err := runGit(dir, "tag", "--list")
+	if err != nil {
+		g.fail(name, err)
+		return nil
+	}
+
+	var vs []*pack.Version
+	for _, tag := range strings.Fields(tags) {
+		v, err := parseTagVersion(tag)
+		if err == nil && !containsVersion(vs, v) {
+			vs = append(vs, v)
+		}
+	}
+	sort.Sort(byVersion(vs))
+
+	g.versions[name] = vs
+	return vs
+}
+
+// GetPack reads the packfile of a version of a package. A version without a
+// packfile gets an empty pack.
+func (g *gitProvider) GetPack(name string, v *pack.Version) *pack.Pack {
+	key := name + " " + v.String()
+	if p, ok := g.packs[key]; ok {
+		return p
+	}
+
+	p := new(pack.Pack)
+	dir, err := g.mirror(name)
+	if err != nil {
+		g.fail(name, err)
+		return p
+	}
+	rev, err := g.revision(dir, name, v)
+	if err != nil {
+		g.fail(name, err)
+		return p
+	}
+
+	// A missing packfile is not an error, the package has no dependencies.
+	found, err := runGit(dir, "ls-tree", "--name-only", rev, "--", PACKFILE)
+	if err != nil {
+		g.fail(name, err)
+	} else if len(found) > 0 {
+		packfile, err := runGit(dir, "show", rev+":"+PACKFILE)
+		if err == nil {
+			err = goyaml.Unmarshal([]byte(packfile), p)
+		}
+		if err != nil {
+			g.fail(name, err)
+		}
+	}
+
+	g.packs[key] = p
+	return p
+}
+
+// GetGraph gets the dependency graph of a version of a package.
+func (g *gitProvider) GetGraph(name string, v *pack.Version) *depgraph {
+	graph, err := newPackGraph(g.GetPack(name, v))
+	if err != nil {
+		g.fail(name, err)
+		graph = &depgraph{head: &depnode{d: &pack.Dependency{Name: name}}}
+	}
+	graph.head.v = v
+	return graph
+}
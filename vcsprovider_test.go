@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/aarondl/pack"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+func TestGitProvider(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	repo := mkGitRepo(t, []string{"v0.1.0", "v1.0.0", "release", "1.1.0"},
+		[]map[string]string{
+			{"apple.go": "package apple"},
+			{PACKFILE: "name: apple\nlicense: MIT\n" +
+				"dependencies:\n- example.com/banana ~1.0.0\n"},
+			{"README": "Not a version."},
+			{PACKFILE: "name: apple\nlicense: BSD\n"},
+		},
+	)
+	defer os.RemoveAll(repo)
+
+	cache := mkTree(t, nil)
+	defer os.RemoveAll(cache)
+	config.Remotes = map[string]string{"example.com/apple": repo}
+	defer func() { config.Remotes = nil }()
+
+	g := newGitProvider(cache)
+	name := "example.com/apple"
+
+	vs := g.GetVersions(name)
+	expect := mkVers("1.1.0", "1.0.0", "0.1.0")
+	if len(vs) != len(expect) {
+		t.Fatal("Expected versions:", expect, "got:", vs)
+	}
+	for i := range vs {
+		if !vs[i].Satisfies(pack.Equal, expect[i]) {
+			t.Fatal("Expected versions:", expect, "got:", vs)
+		}
+	}
+
+	graph := g.GetGraph(name, expect[1])
+	if len(graph.head.kids) != 1 ||
+		graph.head.kids[0].d.Name != "example.com/banana" {
+
+		t.Error("Expected a dependency on banana, got:", graph)
+	}
+	if p := g.GetPack(name, expect[1]); p.License != "MIT" {
+		t.Error("Expected the MIT license, got:", p.License)
+	}
+	if p := g.GetPack(name, expect[0]); p.License != "BSD" {
+		t.Error("Expected the BSD license, got:", p.License)
+	}
+	if graph = g.GetGraph(name, expect[2]); len(graph.head.kids) != 0 {
+		t.Error("Expected no dependencies without a packfile, got:", graph)
+	}
+	if err := g.Err(); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	config.Remotes["example.com/../../escaped"] = repo
+	if vs = g.GetVersions("example.com/../../escaped"); len(vs) != 0 {
+		t.Error("Expected no versions for an invalid name, got:", vs)
+	}
+	if _, err := os.Stat(filepath.Join(cache, "..", "escaped.git")); err == nil {
+		t.Error("Expected nothing to be cloned outside the cache")
+	}
+	if g.Err() == nil {
+		t.Error("Expected the invalid name to be recorded.")
+	}
+	g.failureLog = failureLog{}
+
+	config.Remotes["example.com/missing"] = repo + "/nope"
+	if vs = g.GetVersions("example.com/missing"); len(vs) != 0 {
+		t.Error("Expected no versions, got:", vs)
+	}
+	if g.Err() == nil {
+		t.Error("Expected the failure to be recorded.")
+	}
+}
+
+func TestGitProvider_BrokenPackfile(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	repo := mkGitRepo(t, []string{"v1.0.0"}, []map[string]string{
+		{PACKFILE: "name: apple\n"},
+	})
+	defer os.RemoveAll(repo)
+
+	cache := mkTree(t, nil)
+	defer os.RemoveAll(cache)
+	config.Remotes = map[string]string{"example.com/apple": repo}
+	defer func() { config.Remotes = nil }()
+
+	g := newGitProvider(cache)
+	name := "example.com/apple"
+	dir, err := g.mirror(name)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	// Remove the packfile's object from the mirror so reading it fails.
+	blob, err := runGit(dir, "rev-parse", "v1.0.0:"+PACKFILE)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	object := filepath.Join(dir, "objects", blob[:2], blob[2:])
+	if err = os.Remove(object); err != nil {
+		t.Skip("The packfile's object isn't loose:", err)
+	}
+
+	g.GetPack(name, mkVers("1.0.0")[0])
+	if g.Err() == nil {
+		t.Error("Expected the unreadable packfile to be recorded.")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	vendorDir = "vendor"
+)
+
+// vendorExts are the extensions of the files --trim-files keeps, everything
+// the go tool may build.
+var vendorExts = map[string]bool{
+	".go": true, ".s": true, ".S": true, ".c": true, ".h": true, ".cc": true,
+	".cpp": true, ".cxx": true, ".hh": true, ".hpp": true, ".hxx": true,
+	".m": true, ".f": true, ".F": true, ".for": true, ".f90": true,
+	".syso": true, ".swig": true, ".swigcxx": true,
+}
+
+// vendorLicenses are the prefixes of the files --trim-files keeps to preserve
+// licensing information.
+var vendorLicenses = []string{"LICENSE", "LICENCE", "COPYING", "NOTICE"}
+
+// vendorPath gets the vendor directory of a packfile.
+func vendorPath(file string) string {
+	return filepath.Join(filepath.Dir(file), vendorDir)
+}
+
+// vendorLockPath gets the lockfile recording what was vendored for a
+// packfile.
+func vendorLockPath(file string) string {
+	return filepath.Join(vendorPath(file), PACKLOCK)
+}
+
+// vendorPackages resolves the dependencies of the packfile and installs them
+// into the project's vendor directory instead of the packset. What was
+// vendored is recorded in a lockfile inside the vendor directory so that gp
+// verify can check it. With --trim tests and test data are left out, and with
+// --trim-files everything else the go tool can't build as well.
+func vendorPackages(file string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("vendor", flag.ContinueOnError)
+	flags.SetOutput(out)
+	trim := flags.Bool("trim", false,
+		"Leave out tests and test data.")
+	trimFiles := flags.Bool("trim-files", false,
+		"Also leave out files that aren't built, except licenses. "+
+			"Breaks packages that embed files.")
+	workers := flags.Int("workers", config.Workers,
+		"Number of packages to fetch at once.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	*trim = *trim || *trimFiles
+
+	unlock, err := lockVendor(file, out)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r, err := resolvePackage(file)
+	if err != nil {
+		return err
+	}
+	if err = checkLicenses(r, config.Licenses, out); err != nil {
+		return err
+	}
+	printActivations(r.acts, out)
+
+	lockPath := vendorLockPath(file)
+	vendored, err := loadLockfile(lockPath)
+	if os.IsNotExist(err) {
+		vendored = new(lockfile)
+	} else if err != nil {
+		return err
+	}
+	// Packages vendored with a different --trim are vendored again, but
+	// the ones no longer required must still be removed.
+	previous := vendored
+	if vendored.Trimmed != *trim || vendored.TrimmedFiles != *trimFiles {
+		previous = new(lockfile)
+	}
+
+	f, err := resolutionFetcher(r)
+	if err != nil {
+		return err
+	}
+
+	vendor := vendorPath(file)
+	in := newInstaller(f, *workers, out)
+	in.dir = func(name string) string {
+		return filepath.Join(vendor, filepath.FromSlash(name))
+	}
+	in.tmp = filepath.Dir(vendor)
+	in.copy = true
+
+	s, err := in.stage(r.acts, previous)
+	if err != nil {
+		return err
+	}
+	defer s.discard()
+
+	if *trim {
+		for _, name := range s.stagedNames() {
+			if err = trimTree(s.dir(name), *trimFiles); err != nil {
+				return err
+			}
+		}
+	}
+
+	lock := newLockfile(r.acts)
+	lock.Manifest = manifestHash(r.pack)
+	lock.Trimmed = *trim
+	lock.TrimmedFiles = *trimFiles
+	if err = lockSources(lock, r.vp); err != nil {
+		return err
+	}
+	if err = hashInstalled(lock, previous, s.dir); err != nil {
+		return err
+	}
+	if err = s.swap(); err != nil {
+		return err
+	}
+	if err = lock.save(lockPath); err != nil {
+		return err
+	}
+	s.commit()
+
+	required := make(map[string]bool)
+	for name := range r.acts {
+		required[name] = true
+	}
+	for _, e := range vendored.Packages {
+		if !required[e.Name] && checkPackageName(e.Name) == nil {
+			err = removePackage(in.dir(e.Name), e.Name, required)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = fmt.Fprintf(out, "Vendored %d packages into %s.\n",
+		len(lock.Packages), vendor)
+	return err
+}
+
+// removePackage removes a package from dir, keeping the required packages
+// nested in it.
+func removePackage(dir, name string, required map[string]bool) error {
+	if !leadsToPackage(required, name) {
+		return os.RemoveAll(dir)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		child := path.Join(name, info.Name())
+		childDir := filepath.Join(dir, info.Name())
+		switch {
+		case required[child]:
+			continue
+		case info.IsDir() && leadsToPackage(required, child):
+			err = removePackage(childDir, child, required)
+		default:
+			err = os.RemoveAll(childDir)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trimTree removes the tests and test data of a package. Everything else is
+// kept since any file may be embedded with //go:embed, unless files is set, in
+// which case only the files the go tool builds and licenses are kept.
+func trimTree(dir string, files bool) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && info.Name() == "testdata" {
+				if err = os.RemoveAll(path); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasSuffix(info.Name(), "_test.go") ||
+			(files && !keepVendored(info.Name())) {
+
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// keepVendored checks if --trim-files keeps a file.
+func keepVendored(name string) bool {
+	if vendorExts[filepath.Ext(name)] {
+		return true
+	}
+	upper := strings.ToUpper(name)
+	for _, prefix := range vendorLicenses {
+		if strings.HasPrefix(upper, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyVendored checks the vendored packages of a packfile against the
+// vendor lockfile, returns a nil lockfile if nothing was vendored.
+func verifyVendored(file string) (*lockfile, error) {
+	l, err := loadLockfile(vendorLockPath(file))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	vendor := vendorPath(file)
+	return l, verifyLockfile(l, func(name string) string {
+		return filepath.Join(vendor, filepath.FromSlash(name))
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"github.com/aarondl/pack"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+// trimFiles is a package with files trimTree may remove.
+var trimFiles = map[string]string{
+	"a.go":            "package a",
+	"a_test.go":       "package a",
+	"asm_amd64.s":     "TEXT",
+	"LICENSE.md":      "MIT",
+	"README.md":       "readme",
+	"package.yaml":    "name: a",
+	"sub/b.go":        "package b",
+	"sub/b.txt":       "text",
+	"sub/b_test.go":   "package b",
+	"sub/c.S":         "TEXT",
+	"sub/c.m":         "objc",
+	"testdata/in.go":  "package testdata",
+	"testdata/in.txt": "input",
+}
+
+func TestVendor_TrimTree(t *T) {
+	tests := []struct {
+		files   bool
+		kept    []string
+		removed []string
+	}{
+		{
+			false,
+			[]string{"a.go", "asm_amd64.s", "LICENSE.md", "README.md",
+				"package.yaml", "sub/b.go", "sub/b.txt", "sub/c.S",
+				"sub/c.m"},
+			[]string{"a_test.go", "sub/b_test.go", "testdata"},
+		},
+		{
+			true,
+			[]string{"a.go", "asm_amd64.s", "LICENSE.md", "sub/b.go",
+				"sub/c.S", "sub/c.m"},
+			[]string{"a_test.go", "README.md", "package.yaml",
+				"sub/b.txt", "sub/b_test.go", "testdata"},
+		},
+	}
+
+	for _, test := range tests {
+		dir := mkTree(t, trimFiles)
+		defer os.RemoveAll(dir)
+
+		if err := trimTree(dir, test.files); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+
+		for _, kept := range test.kept {
+			if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+				t.Errorf("Expected %s to be kept (files: %v).",
+					kept, test.files)
+			}
+		}
+		for _, removed := range test.removed {
+			if _, err := os.Stat(filepath.Join(dir, removed)); err == nil {
+				t.Errorf("Expected %s to be removed (files: %v).",
+					removed, test.files)
+			}
+		}
+	}
+}
+
+func TestVendor_LocalRepository(t *T) {
+	if Short() {
+		t.SkipNow()
+	}
+
+	files := map[string]string{
+		"example.com/banana/1.0.0/banana_test.go": "package banana",
+	}
+	for name, contents := range testRepository {
+		files[name] = contents
+	}
+	root := mkTree(t, files)
+	defer os.RemoveAll(root)
+	project := mkTree(t, nil)
+	defer os.RemoveAll(project)
+	gopath := mkTree(t, nil)
+	defer os.RemoveAll(gopath)
+
+	var err error
+	PATHS, err = pack.NewPaths(gopath, DEFAULTSET)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	config.Repository = root
+	defer func() { config.Repository = "" }()
+
+	file := filepath.Join(project, PACKFILE)
+	p := &pack.Pack{Name: "root", Dependencies: []string{
+		"example.com/banana =1.0.0",
+	}}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	var buf bytes.Buffer
+	if err = vendorPackages(file, []string{"--trim"}, &buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	banana := filepath.Join(project, vendorDir, "example.com", "banana")
+	if _, err = os.Stat(filepath.Join(banana, "banana.go")); err != nil {
+		t.Error("Expected banana to be vendored:", err)
+	}
+	if _, err = os.Stat(filepath.Join(banana, "banana_test.go")); err == nil {
+		t.Error("Expected banana's tests to be trimmed")
+	}
+	if _, err = os.Stat(packsetDir("example.com/banana")); err == nil {
+		t.Error("Expected banana not to be installed into the packset")
+	}
+
+	lock, err := loadLockfile(vendorLockPath(file))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if !lock.Trimmed || lock.find("example.com/banana") == nil {
+		t.Error("Expected the vendored packages to be recorded, got:", lock)
+	}
+
+	if err = verifyPackage(file, nil, &buf); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(banana, "banana.go"),
+		[]byte("package changed"), 0664)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, ok := verifyPackage(file, nil, &buf).(integrityError); !ok {
+		t.Error("Expected the changed vendored package to fail verification")
+	}
+
+	// Toggling --trim still removes what's no longer required.
+	p.Dependencies = []string{"example.com/apple =1.1.0"}
+	if err = p.WritePackFile(file); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err = vendorPackages(file, nil, &buf); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err = os.Stat(banana); !os.IsNotExist(err) {
+		t.Error("Expected banana to be removed, got:", err)
+	}
+	apple := filepath.Join(project, vendorDir, "example.com", "apple")
+	if _, err = os.Stat(filepath.Join(apple, "apple.go")); err != nil {
+		t.Error("Expected apple to be vendored:", err)
+	}
+}
+
+func TestVendor_RemovePackage(t *T) {
+	dir := mkTree(t, map[string]string{
+		"a/a.go":          "package a",
+		"a/internal/x.go": "package x",
+		"a/sub/sub.go":    "package sub",
+		"a/sub/deep/d.go": "package deep",
+		"b/b.go":          "package b",
+	})
+	defer os.RemoveAll(dir)
+
+	required := map[string]bool{"a/sub": true}
+	if err := removePackage(filepath.Join(dir, "a"), "a",
+		required); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := removePackage(filepath.Join(dir, "b"), "b",
+		required); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	for _, gone := range []string{"a/a.go", "a/internal", "b"} {
+		if _, err := os.Stat(filepath.Join(dir, gone)); err == nil {
+			t.Error("Expected to be removed:", gone)
+		}
+	}
+	for _, kept := range []string{"a/sub/sub.go", "a/sub/deep/d.go"} {
+		if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+			t.Error("Expected to be kept:", kept)
+		}
+	}
+}
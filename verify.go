@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// integrityError is returned when installed packages don't match the hashes
+// recorded in the lockfile.
+type integrityError []string
+
+// Error lists every package that failed verification.
+func (i integrityError) Error() string {
+	var b bytes.Buffer
+	b.WriteString("Installed packages do not match the lockfile:")
+	for _, problem := range i {
+		b.WriteString("\n ")
+		b.WriteString(problem)
+	}
+	return b.String()
+}
+
+// lockfilePath gets the path of the lockfile that belongs to a packfile.
+func lockfilePath(file string) string {
+	return filepath.Join(filepath.Dir(file), PACKLOCK)
+}
+
+// verifyEntry checks the contents of dir against a lock entry, leaving out the
+// nested packages, returns a description of the problem or an empty string if
+// it matches.
+func verifyEntry(e *lockentry, dir string, nested []string) (string, error) {
+	if len(e.Hash) == 0 {
+		return fmt.Sprintf("%s %s has no recorded hash", e.Name, e.Version),
+			nil
+	}
+
+	hash, err := hashTree(dir, nested)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("%s %s is not installed", e.Name, e.Version), nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if hash != e.Hash {
+		return hashMismatch(e, hash, e.Hash), nil
+	}
+	return "", nil
+}
+
+// hashMismatch describes a package whose contents no longer match.
+func hashMismatch(e *lockentry, hash, expect string) string {
+	return fmt.Sprintf("%s %s has hash %s, expected %s",
+		e.Name, e.Version, hash, expect)
+}
+
+// verifyLockfile checks every entry in the lockfile against the installed
+// packages found by dir.
+func verifyLockfile(l *lockfile, dir func(string) string) error {
+	var problems integrityError
+	names := l.names()
+	for _, e := range l.Packages {
+		problem, err := verifyEntry(e, dir(e.Name),
+			nestedPackages(e.Name, names))
+		if err != nil {
+			return err
+		}
+		if len(problem) > 0 {
+			problems = append(problems, problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// verifyPackage checks the packages installed in the packset against the
+// lockfile of the packfile, and the vendored packages against the vendor
+// lockfile if there is one.
+func verifyPackage(file string, args []string, out io.Writer) error {
+	vendored, err := verifyVendored(file)
+	if err != nil {
+		return err
+	}
+	if vendored != nil {
+		fmt.Fprintf(out, "Verified %d vendored packages.\n",
+			len(vendored.Packages))
+	}
+
+	l, err := loadLockfile(lockfilePath(file))
+	if os.IsNotExist(err) && vendored != nil {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err = verifyLockfile(l, packsetDir); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "Verified %d packages.\n", len(l.Packages))
+	return err
+}
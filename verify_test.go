@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	. "testing"
+)
+
+func TestVerify(t *T) {
+	dir := mkTree(t, map[string]string{
+		"apple/apple.go":   "package apple",
+		"banana/banana.go": "package banana",
+	})
+	defer os.RemoveAll(dir)
+	pkgdir := func(name string) string { return filepath.Join(dir, name) }
+
+	l := &lockfile{Packages: []*lockentry{
+		{Name: "apple", Version: "1.0.0"},
+		{Name: "banana", Version: "1.0.0"},
+	}}
+	if err := hashInstalled(l, new(lockfile), pkgdir); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := verifyLockfile(l, pkgdir); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+
+	ioutil.WriteFile(pkgdir("apple/apple.go"), []byte("package evil"), 0660)
+	os.RemoveAll(pkgdir("banana"))
+
+	err := verifyLockfile(l, pkgdir)
+	if ierr, ok := err.(integrityError); !ok || len(ierr) != 2 {
+		t.Error("Expected two integrity problems, got:", err)
+	}
+
+	relock := &lockfile{Packages: []*lockentry{
+		{Name: "apple", Version: "1.0.0"},
+	}}
+	err = hashInstalled(relock, l, pkgdir)
+	if ierr, ok := err.(integrityError); !ok || len(ierr) != 1 {
+		t.Error("Expected the changed package to be caught, got:", err)
+	}
+}